@@ -0,0 +1,266 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionDeploy   = "deploy"
+	ActionCancel   = "cancel"
+	ActionApprove  = "approve" // CI checks releasing or dropping a held deployment
+	ActionRollback = "rollback"
+	ActionReload   = "reload"
+	ActionAccess   = "access" // a request refused by the security middleware
+)
+
+// Outcomes of an audited action
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+// SystemIdentity performs the actions nobody asked for over the API, such
+// as webhook deployments, automatic rollbacks and reloads on SIGHUP
+const SystemIdentity = "system"
+
+// Entry is one line of the audit log. Hash is the SHA-256 of the entry
+// with an empty Hash, and covers PrevHash, the hash of the entry before,
+// so changing or removing an entry breaks the chain from there on.
+type Entry struct {
+	Seq        int64     `json:"seq"`
+	Time       time.Time `json:"time"`
+	Identity   string    `json:"identity"`
+	Credential string    `json:"credential,omitempty"` // e.g. "api_keys" or "client certificate ci.example.com"
+	SourceIP   string    `json:"source_ip,omitempty"`
+	Action     string    `json:"action"`
+	Outcome    string    `json:"outcome"`
+	App        string    `json:"app,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"` // the deployment acted on
+	Detail     string    `json:"detail,omitempty"`
+	PrevHash   string    `json:"prev_hash"`
+	Hash       string    `json:"hash"`
+}
+
+// Filter narrows down an audit query; zero values match everything
+type Filter struct {
+	Identity  string
+	Action    string
+	Outcome   string
+	App       string
+	RequestID string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+// Log is an append-only, hash-chained audit log backed by a JSON lines
+// file. Unlike the deployment history it is never pruned or rewritten, so
+// only the last entry is kept in memory and queries read the file.
+type Log struct {
+	path  string
+	mutex sync.RWMutex
+	file  *os.File
+	last  *Entry // nil while the log is empty
+}
+
+// Open opens (or creates) the audit log at path and finds its last entry
+func Open(path string) (*Log, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create audit log directory %s: %w", dir, err)
+		}
+	}
+
+	l := &Log{path: path}
+	err := scanEntries(path, func(entry *Entry) {
+		if entry != nil {
+			l.last = entry
+		}
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	l.file = file
+	return l, nil
+}
+
+// Record appends an entry to the log, chaining it to the previous one
+func (l *Log) Record(entry Entry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	entry.Seq = 1
+	entry.PrevHash = ""
+	if l.last != nil {
+		entry.Seq = l.last.Seq + 1
+		entry.PrevHash = l.last.Hash
+	}
+	entry.Time = time.Now().UTC()
+	entry.Hash = entry.computeHash()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	l.last = &entry
+	return nil
+}
+
+// Query returns entries matching the filter, newest first. The file is
+// read from the start, holding on to no more than Limit matches.
+func (l *Log) Query(filter Filter) ([]*Entry, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	// Once Limit matches are held, each newer one replaces the oldest
+	var matches []*Entry
+	oldest := 0
+	err := scanEntries(l.path, func(entry *Entry) {
+		if entry == nil || !filter.Matches(entry) {
+			return
+		}
+		if filter.Limit > 0 && len(matches) == filter.Limit {
+			matches[oldest] = entry
+			oldest = (oldest + 1) % filter.Limit
+			return
+		}
+		matches = append(matches, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	matches = slices.Concat(matches[oldest:], matches[:oldest])
+	slices.Reverse(matches)
+	return matches, nil
+}
+
+// Verify reads the log file and checks its hash chain. It returns the
+// number of entries that verified, and an error describing the first entry
+// that was altered, removed or inserted. Entries missing from the end of
+// the file are detected as long as the log has been open since they were
+// written.
+func (l *Log) Verify() (int, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	var previous *Entry
+	var broken error
+	verified := 0
+	err := scanEntries(l.path, func(entry *Entry) {
+		if broken != nil {
+			return
+		}
+		switch {
+		case entry == nil:
+			broken = fmt.Errorf("line %d is not an audit entry", verified+1)
+		case entry.Hash != entry.computeHash():
+			broken = fmt.Errorf("entry %d has been altered", entry.Seq)
+		case previous == nil && (entry.Seq != 1 || entry.PrevHash != ""):
+			broken = fmt.Errorf("entries before %d are missing", entry.Seq)
+		case previous != nil && (entry.Seq != previous.Seq+1 || entry.PrevHash != previous.Hash):
+			broken = fmt.Errorf("chain broken between entries %d and %d", previous.Seq, entry.Seq)
+		default:
+			previous = entry
+			verified++
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if broken != nil {
+		return verified, broken
+	}
+
+	if l.last != nil && (previous == nil || previous.Seq < l.last.Seq) {
+		return verified, fmt.Errorf("log ends at entry %d but %d were written", verified, l.last.Seq)
+	}
+	return verified, nil
+}
+
+// Close closes the underlying audit file
+func (l *Log) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file != nil {
+		return l.file.Close()
+	}
+	return nil
+}
+
+// Matches reports whether the entry satisfies the filter
+func (f Filter) Matches(e *Entry) bool {
+	if f.Identity != "" && e.Identity != f.Identity {
+		return false
+	}
+	if f.Action != "" && e.Action != f.Action {
+		return false
+	}
+	if f.Outcome != "" && e.Outcome != f.Outcome {
+		return false
+	}
+	if f.App != "" && e.App != f.App {
+		return false
+	}
+	if f.RequestID != "" && e.RequestID != f.RequestID {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// computeHash returns the hex SHA-256 of the entry without its hash
+func (e Entry) computeHash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// scanEntries calls fn with every line of an audit file in order, with nil
+// for lines that don't parse
+func scanEntries(path string, fn func(*Entry)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			fn(nil)
+			continue
+		}
+		fn(&entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log %s: %w", path, err)
+	}
+	return nil
+}
@@ -1,9 +1,15 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -12,9 +18,36 @@ import (
 // Config holds all configuration for the deployment orchestrator
 type Config struct {
 	// Server settings
-	Port         string `toml:"port"`
-	WebhookSecret string `toml:"webhook_secret"`
-	APIKey       string `toml:"api_key"`
+	Port            string `toml:"port"`
+	WebhookSecret   string `toml:"webhook_secret"`
+	APIKey          string `toml:"api_key"`
+	GitLabToken     string `toml:"gitlab_token"`     // X-Gitlab-Token; defaults to webhook_secret
+	GiteaSecret     string `toml:"gitea_secret"`     // X-Gitea-Signature key; defaults to webhook_secret
+	BitbucketSecret string `toml:"bitbucket_secret"` // X-Hub-Signature key; defaults to webhook_secret
+
+	// Files holding the secrets above, e.g. mounted Docker or Kubernetes
+	// secrets; a file takes precedence over a value from the same source
+	WebhookSecretFile   string `toml:"webhook_secret_file"`
+	APIKeyFile          string `toml:"api_key_file"`
+	GitLabTokenFile     string `toml:"gitlab_token_file"`
+	GiteaSecretFile     string `toml:"gitea_secret_file"`
+	BitbucketSecretFile string `toml:"bitbucket_secret_file"`
+
+	// Named API keys with scopes; api_key acts as a key with every scope
+	APIKeys map[string]APIKey `toml:"api_keys"`
+
+	// TLS; without a certificate the server speaks plain HTTP. The files
+	// are read again when they change or the configuration is reloaded.
+	TLSCert           string `toml:"tls_cert"`
+	TLSKey            string `toml:"tls_key"`
+	TLSClientCA       string `toml:"tls_client_ca"`           // CAs for client certificates on API endpoints
+	RequireClientCert bool   `toml:"tls_require_client_cert"` // API endpoints only accept [client_certs]
+
+	// Identities of client certificates, with scopes like API keys
+	ClientCerts map[string]ClientCert `toml:"client_certs"`
+
+	// Generic webhook credentials per app (/hooks/generic/{app})
+	GenericHooks map[string]GenericHook `toml:"generic_hooks"`
 
 	// Logging
 	LogFile string `toml:"log_file"`
@@ -22,16 +55,41 @@ type Config struct {
 	// Repository mappings (repo -> local path)
 	RepoMap map[string]string `toml:"repositories"`
 
+	// App identifiers (repo -> app); without an entry a repository's app is
+	// named after the last part of the repository name
+	Apps map[string]string `toml:"apps"`
+
+	// Repositories deploying several apps, each from its own paths
+	Monorepos map[string][]MonorepoApp `toml:"monorepo"`
+
 	// Commands per app
 	Commands        map[string]string `toml:"commands"`
 	DefaultCommands string            `toml:"default_commands"`
 
+	// Structured pipelines per app; take precedence over Commands
+	Pipelines map[string][]Step `toml:"pipelines"`
+
+	// Fetch and check out the exact commit being deployed before running commands
+	GitCheckout bool `toml:"git_checkout"`
+
 	// Rollback commands per app
 	RollbackCommands map[string]string `toml:"rollback_commands"`
 
 	// Branch filtering
 	BranchFilter string `toml:"branch_filter"`
 
+	// Branch rules per app; apps with environments ignore BranchFilter
+	Environments map[string][]Environment `toml:"environments"`
+
+	// Tag and release triggers per app
+	Triggers map[string]Trigger `toml:"triggers"`
+
+	// Pull request preview environments per app
+	Previews map[string]Preview `toml:"previews"`
+
+	// Apps whose pushes wait for CI to pass on the commit before deploying
+	Checks map[string]CheckGate `toml:"checks"`
+
 	// Concurrency and timeouts
 	ConcurrencyLimit int           `toml:"concurrency_limit"`
 	TimeoutSeconds   int           `toml:"timeout_seconds"`
@@ -41,36 +99,184 @@ type Config struct {
 	NotifyOnRollback bool `toml:"notify_on_rollback"`
 
 	// Security
-	IPAllowlist []string `toml:"ip_allowlist"`
+	IPAllowlist    []string `toml:"ip_allowlist"`
+	TrustedProxies []string `toml:"trusted_proxies"`  // proxies whose forwarded headers are believed
+	ClientIPHeader string   `toml:"client_ip_header"` // the header those proxies set
 
 	// Features
 	DryRun bool `toml:"dry_run"`
+
+	// Deployment history
+	HistoryFile           string `toml:"history_file"`
+	HistoryRetentionDays  int    `toml:"history_retention_days"`   // 0 keeps records forever
+	HistoryMaxEntries     int    `toml:"history_max_entries"`      // 0 means no limit
+	HistoryMaxOutputBytes int    `toml:"history_max_output_bytes"` // 0 keeps all output
+
+	// Hash-chained log of privileged actions; never pruned
+	AuditFile string `toml:"audit_file"`
+
+	// Webhook replay protection
+	DeliveryFile         string `toml:"delivery_file"`
+	DeliveryWindow       int    `toml:"delivery_window"`         // delivery IDs remembered; 0 disables deduplication
+	WebhookMaxAgeMinutes int    `toml:"webhook_max_age_minutes"` // 0 accepts pushes of any age
+
+	// Path is the file the configuration was loaded from
+	Path string `toml:"-"`
+
+	// sources records where each key's value came from
+	sources map[string]string
+
+	// notes are the settings moved from short app names while loading
+	notes []string
+}
+
+// GenericHook holds the credentials accepted by an app's generic webhook.
+// Either may be set; a request passing either check is accepted.
+type GenericHook struct {
+	Secret string `toml:"secret"` // HMAC-SHA256 key for X-Signature-256
+	Token  string `toml:"token"`  // bearer token
+}
+
+// APIKey is a named key for the API. Only the SHA-256 digest of the key
+// is stored, as "sha256:<hex>" or plain hex. Scopes are "admin",
+// "logs:read", "audit:read", "deploy:*" or "deploy:<app>".
+type APIKey struct {
+	Hash    string    `toml:"hash"`
+	Scopes  []string  `toml:"scopes"`
+	Expires time.Time `toml:"expires"` // zero means the key never expires
 }
 
-// Load reads configuration from config.toml file in multiple locations
+// Digest decodes the key's hash
+func (k APIKey) Digest() ([]byte, error) {
+	digest, err := hex.DecodeString(strings.TrimPrefix(k.Hash, "sha256:"))
+	if err != nil || len(digest) != sha256.Size {
+		return nil, fmt.Errorf("hash must be a hex SHA-256 digest, optionally prefixed with \"sha256:\"")
+	}
+	return digest, nil
+}
+
+// ClientCert gives TLS client certificates an identity. A certificate
+// matches if its common name or one of its DNS, email or URI SANs is
+// listed in Subjects. Scopes are those of an APIKey.
+type ClientCert struct {
+	Subjects []string `toml:"subjects"`
+	Scopes   []string `toml:"scopes"`
+}
+
+// Trigger opts an app into tag and release deployments
+type Trigger struct {
+	Tags     []string `toml:"tags"`     // glob patterns, e.g. "v*"
+	Releases bool     `toml:"releases"` // deploy on GitHub "release published"
+}
+
+// MonorepoApp is one of several apps deployed from the same repository.
+// A push deploys it only if a changed file matches Include (every file does
+// when Include is empty) and not Exclude. Patterns are slash-separated
+// globs where "**" matches any number of directories.
+type MonorepoApp struct {
+	App     string   `toml:"app"`
+	Path    string   `toml:"path"` // defaults to the repository mapping
+	Include []string `toml:"include"`
+	Exclude []string `toml:"exclude"`
+}
+
+// Environment maps branches of an app to a deployment target. The first
+// environment with a matching pattern wins. Path, commands and rollback
+// default to the app's regular settings.
+type Environment struct {
+	Name     string   `toml:"name"`
+	Branches []string `toml:"branches"` // glob patterns, e.g. "release/*"
+	Path     string   `toml:"path"`
+	Commands string   `toml:"commands"`
+	Steps    []Step   `toml:"steps"`
+	Rollback string   `toml:"rollback"`
+}
+
+// CheckGate holds an app's deployments until a GitHub workflow_run or
+// check_suite reports success for the pushed commit
+type CheckGate struct {
+	Workflows      []string `toml:"workflows"`       // workflow or check suite app names that must all pass
+	TimeoutMinutes int      `toml:"timeout_minutes"` // give up after this long; 0 means 60
+}
+
+// Preview configures per-PR preview deployments of an app. Path is a
+// template where {path} is the app's mapped path, {app} its name and {pr}
+// the pull request number; it defaults to "{path}-pr-{pr}". Without
+// Steps or Commands the app's regular pipeline is used.
+type Preview struct {
+	Path          string `toml:"path"`
+	Commands      string `toml:"commands"`
+	Steps         []Step `toml:"steps"`
+	Teardown      string `toml:"teardown"` // run before the directory is removed
+	TeardownSteps []Step `toml:"teardown_steps"`
+	AllowForks    bool   `toml:"allow_forks"` // also preview pull requests from forks
+}
+
+// Step is a single named step of a deployment pipeline
+type Step struct {
+	Name            string            `toml:"name"`
+	Command         string            `toml:"command"`
+	Dir             string            `toml:"dir"`             // relative to the repository
+	TimeoutSeconds  int               `toml:"timeout_seconds"` // 0 means only the deployment timeout applies
+	Env             map[string]string `toml:"env"`
+	ContinueOnError bool              `toml:"continue_on_error"`
+	AlwaysRun       bool              `toml:"always_run"` // run even after an earlier step failed
+}
+
+// Load reads configuration from the file named by CICD_CONFIG or, if that
+// isn't set, the first config.toml in the search locations
 func Load() (*Config, error) {
+	if configPath := os.Getenv(envPrefix + "CONFIG"); configPath != "" {
+		return LoadFile(configPath)
+	}
+
+	// Find config file in multiple locations
+	configPath, err := findConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	return LoadFile(configPath)
+}
+
+// LoadFile reads and validates the configuration in configPath. CICD_*
+// environment variables and secret files override the file's values.
+func LoadFile(configPath string) (*Config, error) {
 	cfg := &Config{
 		// Set defaults
 		Port:             "3000",
 		LogFile:          "./deployer.log",
 		DefaultCommands:  "git pull && npm ci && npm run build",
+		GitCheckout:      true,
 		BranchFilter:     "main",
 		ConcurrencyLimit: 2,
 		TimeoutSeconds:   300,
 		NotifyOnRollback: false,
 		DryRun:           false,
-	}
 
-	// Find config file in multiple locations
-	configPath, err := findConfigFile()
-	if err != nil {
-		return nil, err
+		ClientIPHeader: "X-Forwarded-For",
+
+		HistoryFile:           "./history.jsonl",
+		HistoryRetentionDays:  30,
+		HistoryMaxEntries:     1000,
+		HistoryMaxOutputBytes: 1 << 20,
+
+		AuditFile: "./audit.jsonl",
+
+		DeliveryFile:   "./deliveries.jsonl",
+		DeliveryWindow: 10000,
 	}
 
 	// Decode TOML file
-	if _, err := toml.DecodeFile(configPath, cfg); err != nil {
+	meta, err := toml.DecodeFile(configPath, cfg)
+	if err != nil {
 		return nil, fmt.Errorf("error loading config file %s: %w", configPath, err)
 	}
+	cfg.Path = configPath
+
+	// Environment variables and secret files win over the file
+	if err := cfg.applyOverrides(meta); err != nil {
+		return nil, err
+	}
 
 	// Compute derived fields
 	cfg.Timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
@@ -80,30 +286,44 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("configuration validation failed: %w", err)
 	}
 
+	// Per-app settings written for the old short app names keep working
+	cfg.notes = cfg.migrateShortNames()
+
 	return cfg, nil
 }
 
-// findConfigFile searches for config.toml in multiple locations
-func findConfigFile() (string, error) {
-	// Define search paths in order of preference
-	searchPaths := []string{
-		"./config.toml",                    // Current directory
-		"./config/config.toml",             // Local config directory
-		"/etc/cicd-thing/config.toml",       // System-wide config
+// Locate returns the first existing config.toml in the search locations
+func Locate() (string, bool) {
+	for _, path := range searchPaths() {
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// searchPaths lists the config file locations in order of preference
+func searchPaths() []string {
+	paths := []string{
+		"./config.toml",                         // Current directory
+		"./config/config.toml",                  // Local config directory
+		"/etc/cicd-thing/config.toml",           // System-wide config
 		"/usr/local/etc/cicd-thing/config.toml", // Alternative system config
 	}
 
 	// Add user home directory path
 	if homeDir, err := os.UserHomeDir(); err == nil {
-		searchPaths = append(searchPaths, filepath.Join(homeDir, ".config", "cicd-thing", "config.toml"))
+		paths = append(paths, filepath.Join(homeDir, ".config", "cicd-thing", "config.toml"))
 	}
+	return paths
+}
 
+// findConfigFile searches for config.toml in multiple locations
+func findConfigFile() (string, error) {
 	// Search for existing config file
-	for _, path := range searchPaths {
-		if _, err := os.Stat(path); err == nil {
-			fmt.Printf("Found config file: %s\n", path)
-			return path, nil
-		}
+	if path, found := Locate(); found {
+		fmt.Printf("Found config file: %s\n", path)
+		return path, nil
 	}
 
 	// No config file found, create default in current directory
@@ -117,7 +337,7 @@ func findConfigFile() (string, error) {
 	fmt.Printf("Please edit this file with your settings before running the application again.\n")
 	fmt.Printf("Required fields to configure:\n")
 	fmt.Printf("  - webhook_secret: Your GitHub webhook secret\n")
-	fmt.Printf("  - api_key: Your API key for authentication\n")
+	fmt.Printf("  - api_key or [api_keys]: API keys for authentication\n")
 	fmt.Printf("  - repositories: Map of repository names to local paths\n")
 	fmt.Printf("===============================\n\n")
 
@@ -139,6 +359,23 @@ func createDefaultConfig(path string) error {
 port = "3000"
 webhook_secret = "YOUR_WEBHOOK_SECRET_HERE"  # REQUIRED: Set your GitHub webhook secret
 api_key = "YOUR_API_KEY_HERE"                # REQUIRED: Set your API key
+# gitlab_token = "YOUR_GITLAB_TOKEN_HERE"    # Optional: GitLab secret token (defaults to webhook_secret)
+# gitea_secret = "YOUR_GITEA_SECRET_HERE"    # Optional: Gitea/Forgejo webhook secret (defaults to webhook_secret)
+# bitbucket_secret = "YOUR_BITBUCKET_SECRET" # Optional: Bitbucket webhook secret (defaults to webhook_secret)
+# Secrets can also come from files (e.g. Docker/Kubernetes secrets) or from
+# CICD_* environment variables, which override every key in this file:
+# webhook_secret_file = "/run/secrets/webhook_secret"
+# api_key_file = "/run/secrets/api_key"
+
+# HTTPS without a reverse proxy (optional); certificate files are picked up
+# again when they change, e.g. after a renewal
+# tls_cert = "/etc/cicd-thing/cert.pem"
+# tls_key = "/etc/cicd-thing/key.pem"
+# Accept client certificates signed by these CAs on the API endpoints;
+# /webhook never asks for one. With tls_require_client_cert, API keys
+# alone are no longer enough.
+# tls_client_ca = "/etc/cicd-thing/clients-ca.pem"
+# tls_require_client_cert = false
 
 # Logging
 log_file = "./deployer.log"
@@ -146,6 +383,11 @@ log_file = "./deployer.log"
 # Default commands to run for deployments
 default_commands = "git pull && npm ci && npm run build"
 
+# Check out the exact commit being deployed before running commands.
+# When enabled, plain "git pull" steps are skipped since they would move
+# the working tree away from that commit.
+git_checkout = true
+
 # Branch filtering (only deploy from this branch)
 branch_filter = "main"
 
@@ -161,6 +403,30 @@ dry_run = false
 
 # Security (optional)
 # ip_allowlist = ["192.168.1.0/24", "10.0.0.0/8"]
+# Behind a reverse proxy, list it here so the client address is taken from
+# Forwarded / X-Forwarded-For; those headers are ignored from anyone else
+# trusted_proxies = ["127.0.0.1", "10.0.0.0/8"]
+# The one header they set: X-Forwarded-For (default), Forwarded or X-Real-IP
+# client_ip_header = "X-Forwarded-For"
+
+# Deployment history (kept across restarts)
+history_file = "./history.jsonl"
+history_retention_days = 30  # 0 keeps records forever
+history_max_entries = 1000   # 0 means no limit
+# Keep only the last MB of each deployment's output; 0 keeps all of it
+history_max_output_bytes = 1048576
+
+# Audit log of deployments, cancellations, rollbacks, reloads and refused
+# requests; hash-chained so tampering shows up, and never pruned
+audit_file = "./audit.jsonl"
+
+# Webhook replay protection: the IDs of the last delivery_window deliveries
+# are remembered, and a delivery seen before is answered "already
+# processed" without deploying again (0 disables this)
+delivery_file = "./deliveries.jsonl"
+delivery_window = 10000
+# Ignore pushes whose commit is older than this many minutes (0 = off)
+webhook_max_age_minutes = 0
 
 # Repository mappings - REQUIRED
 # Map repository names to local deployment paths
@@ -168,6 +434,29 @@ dry_run = false
 # "my-app" = "/var/www/my-app"
 # "api-service" = "/opt/api-service"
 
+# App identifiers (optional)
+# Commands, locks, history and every other per-app setting are keyed by the
+# app id. It defaults to the part of the repository name after the last
+# slash, so give repositories that share that part distinct ids here.
+# [apps]
+# "acme/api" = "acme-api"
+# "contoso/api" = "contoso-api"
+
+# Monorepos deploying several apps (optional)
+# Each app deploys only when a pushed commit changes a file matching its
+# include patterns ("**" spans directories) and not its exclude patterns.
+# Commands, rollback and other per-app settings use the app name.
+# [[monorepo."acme/platform"]]
+# app = "api-service"
+# path = "/opt/api-service"        # defaults to the repository mapping
+# include = ["services/api/**", "go.mod"]
+# exclude = ["**/*.md"]
+#
+# [[monorepo."acme/platform"]]
+# app = "frontend"
+# path = "/var/www/frontend"
+# include = ["web/frontend/**"]
+
 # Per-application deployment commands (optional)
 [commands]
 # "my-app" = "git pull && npm ci && npm run build && pm2 restart my-app"
@@ -177,6 +466,84 @@ dry_run = false
 [rollback_commands]
 # "my-app" = "git checkout HEAD~1 && npm ci && npm run build && pm2 restart my-app"
 # "api-service" = "git checkout HEAD~1 && go build && systemctl restart api-service"
+
+# Branch rules per application (optional)
+# Map branch patterns to environments, each with its own path, commands and
+# rollback (defaulting to the app's regular settings). The first matching
+# environment wins; apps with environments ignore branch_filter.
+# [[environments.my-app]]
+# name = "production"
+# branches = ["main"]
+#
+# [[environments.my-app]]
+# name = "staging"
+# branches = ["develop"]
+# path = "/var/www/my-app-staging"
+#
+# [[environments.my-app]]
+# name = "qa"
+# branches = ["release/*"]
+# path = "/var/www/my-app-qa"
+# commands = "npm ci && npm run build"
+# rollback = "git checkout HEAD~1"
+
+# Tag and release triggers per application (optional)
+# Tag pushes matching a pattern and published GitHub releases deploy the tag;
+# commands receive it as $DEPLOY_TAG.
+# [triggers.my-app]
+# tags = ["v*"]
+# releases = true
+
+# Pull request preview environments per application (optional)
+# Opened/updated PRs are checked out into their own directory and deployed;
+# closing the PR runs the teardown and deletes the directory.
+# [previews.my-app]
+# path = "/var/www/{app}-pr-{pr}"   # default "{path}-pr-{pr}"
+# commands = "npm ci && npm run build && pm2 start --name my-app-pr-$DEPLOY_PR"
+# teardown = "pm2 delete my-app-pr-$DEPLOY_PR"
+# allow_forks = false   # forks run untrusted code on this host
+
+# Deploy only after CI passes (optional, GitHub)
+# Pushes are held as PENDING_CHECKS until a workflow_run or check_suite
+# webhook reports success for the same commit, and dropped if CI fails.
+# [checks.my-app]
+# workflows = ["CI"]      # required; every one must pass on the commit
+# timeout_minutes = 60
+
+# Generic webhook credentials per application (optional)
+# Enables POST /hooks/generic/<app> for Jenkins, Drone, scripts, ...
+# [generic_hooks.my-app]
+# secret = "HMAC_SECRET"   # body signed as X-Signature-256: sha256=<hex>, with a delivery_id
+# token = "BEARER_TOKEN"   # or Authorization: Bearer <token>
+
+# Named API keys with scopes, stored as SHA-256 hashes of the key
+# (echo -n "$KEY" | sha256sum). Scopes: admin, logs:read, audit:read,
+# deploy:* or deploy:<app>. api_key above acts as a key with every scope.
+# [api_keys.ci]
+# hash = "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+# scopes = ["deploy:my-app", "logs:read"]
+# expires = 2027-01-01
+
+# Identities for client certificates, matched by CN or SAN, with the same
+# scopes as API keys
+# [client_certs.ci]
+# subjects = ["ci.internal.example.com"]
+# scopes = ["deploy:*"]
+
+# Per-application pipelines (optional, take precedence over [commands])
+# Each step runs in order; a failed step stops the pipeline unless
+# continue_on_error is set, and always_run steps run regardless.
+# [[pipelines.my-app]]
+# name = "install"
+# command = "npm ci"
+# dir = "frontend"
+# timeout_seconds = 120
+# env = { NODE_ENV = "production" }
+#
+# [[pipelines.my-app]]
+# name = "cleanup"
+# command = "rm -rf .cache/tmp"
+# always_run = true
 `
 
 	return os.WriteFile(path, []byte(defaultConfig), 0644)
@@ -185,13 +552,248 @@ dry_run = false
 // validate checks that required configuration is present
 func (c *Config) validate() error {
 	if c.WebhookSecret == "" {
-		return fmt.Errorf("WEBHOOK_SECRET is required")
+		return fmt.Errorf("webhook_secret is required (or CICD_WEBHOOK_SECRET, or webhook_secret_file)")
 	}
-	if c.APIKey == "" {
-		return fmt.Errorf("API_KEY is required")
+	if c.APIKey == "" && len(c.APIKeys) == 0 {
+		return fmt.Errorf("api_key or [api_keys] is required (or CICD_API_KEY, or api_key_file)")
+	}
+	for name, key := range c.APIKeys {
+		if _, err := key.Digest(); err != nil {
+			return fmt.Errorf("api key %s: %w", name, err)
+		}
+		if len(key.Scopes) == 0 {
+			return fmt.Errorf("api key %s has no scopes", name)
+		}
+		for _, scope := range key.Scopes {
+			if !validScope(scope) {
+				return fmt.Errorf("api key %s: unknown scope %q", name, scope)
+			}
+		}
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("tls_cert and tls_key must be set together")
+	}
+	if c.TLSClientCA != "" && c.TLSCert == "" {
+		return fmt.Errorf("tls_client_ca needs tls_cert and tls_key")
+	}
+	if (c.RequireClientCert || len(c.ClientCerts) > 0) && c.TLSClientCA == "" {
+		return fmt.Errorf("[client_certs] and tls_require_client_cert need tls_client_ca")
+	}
+	subjects := make(map[string]string)
+	for _, name := range sortedKeys(c.ClientCerts) {
+		cert := c.ClientCerts[name]
+		if len(cert.Subjects) == 0 || len(cert.Scopes) == 0 {
+			return fmt.Errorf("client cert %s needs subjects and scopes", name)
+		}
+		for _, subject := range cert.Subjects {
+			if other, taken := subjects[subject]; taken {
+				return fmt.Errorf("client certs %s and %s both list subject %q", other, name, subject)
+			}
+			subjects[subject] = name
+		}
+		for _, scope := range cert.Scopes {
+			if !validScope(scope) {
+				return fmt.Errorf("client cert %s: unknown scope %q", name, scope)
+			}
+		}
+	}
+	for _, app := range sortedKeys(c.Checks) {
+		workflows := c.Checks[app].Workflows
+		if len(workflows) == 0 {
+			return fmt.Errorf("checks for %s: list the workflows to wait for", app)
+		}
+		for i, workflow := range workflows {
+			if slices.Contains(workflows[:i], workflow) {
+				return fmt.Errorf("checks for %s: workflow %q is listed twice", app, workflow)
+			}
+		}
+	}
+	if !validClientIPHeader(c.ClientIPHeader) {
+		return fmt.Errorf("client_ip_header must be X-Forwarded-For, Forwarded or X-Real-IP, got %q", c.ClientIPHeader)
 	}
 	if len(c.RepoMap) == 0 {
-		return fmt.Errorf("REPO_MAP is required")
+		return fmt.Errorf("[repositories] is required (or CICD_REPOSITORIES)")
+	}
+	for repo, app := range c.Apps {
+		if _, exists := c.RepoMap[repo]; !exists {
+			return fmt.Errorf("app %s: repository %s has no mapping", app, repo)
+		}
+		if app == "" || strings.Contains(app, "/") {
+			return fmt.Errorf("repository %s: app id %q must be non-empty and contain no slash", repo, app)
+		}
+		if _, exists := c.Monorepos[repo]; exists {
+			return fmt.Errorf("repository %s is a monorepo; name its apps in [[monorepo]] instead of [apps]", repo)
+		}
+	}
+	owners := make(map[string]string)
+	for _, repo := range sortedKeys(c.RepoMap) {
+		if _, exists := c.Monorepos[repo]; exists {
+			continue
+		}
+		app := c.AppID(repo)
+		if other, taken := owners[app]; taken {
+			return fmt.Errorf("repositories %s and %s both deploy app %q; give them distinct ids under [apps]", other, repo, app)
+		}
+		owners[app] = repo
+	}
+	for repo, apps := range c.Monorepos {
+		if _, exists := c.RepoMap[repo]; !exists {
+			return fmt.Errorf("monorepo %s has no repository mapping", repo)
+		}
+		seen := make(map[string]bool)
+		for _, app := range apps {
+			if app.App == "" {
+				return fmt.Errorf("app of monorepo %s has no name", repo)
+			}
+			if seen[app.App] {
+				return fmt.Errorf("duplicate app %s in monorepo %s", app.App, repo)
+			}
+			seen[app.App] = true
+			if other, taken := owners[app.App]; taken && other != repo {
+				return fmt.Errorf("repositories %s and %s both deploy app %q; give them distinct ids", other, repo, app.App)
+			}
+			owners[app.App] = repo
+		}
+	}
+	for app, environments := range c.Environments {
+		seen := make(map[string]bool)
+		for _, env := range environments {
+			if env.Name == "" {
+				return fmt.Errorf("environment of app %s has no name", app)
+			}
+			if seen[env.Name] {
+				return fmt.Errorf("duplicate environment %s for app %s", env.Name, app)
+			}
+			seen[env.Name] = true
+			if len(env.Branches) == 0 {
+				return fmt.Errorf("environment %s of app %s has no branches", env.Name, app)
+			}
+			for _, pattern := range env.Branches {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("environment %s of app %s: bad branch pattern %q", env.Name, app, pattern)
+				}
+			}
+		}
 	}
 	return nil
 }
+
+// validScope reports whether an API key can carry scope
+func validScope(scope string) bool {
+	switch scope {
+	case "admin", "logs:read", "audit:read", "deploy:*":
+		return true
+	}
+	app, found := strings.CutPrefix(scope, "deploy:")
+	return found && app != "" && !strings.Contains(app, "/")
+}
+
+// validClientIPHeader reports whether client IPs can be read from header
+func validClientIPHeader(header string) bool {
+	for _, name := range []string{"X-Forwarded-For", "Forwarded", "X-Real-IP"} {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// AppID returns the identifier of the app deployed from a repository: its
+// [apps] entry, or the last part of the repository name for configs that
+// predate explicit ids. For example "octocat/Hello-World" -> "Hello-World",
+// and for GitLab subgroups "group/subgroup/app" -> "app".
+func (c *Config) AppID(repoFullName string) string {
+	if app, exists := c.Apps[repoFullName]; exists {
+		return app
+	}
+	return shortName(repoFullName)
+}
+
+// shortName returns the part of a repository name after the last slash
+func shortName(repoFullName string) string {
+	if i := strings.LastIndex(repoFullName, "/"); i >= 0 {
+		return repoFullName[i+1:]
+	}
+	return repoFullName
+}
+
+// Notes lists the per-app settings that were moved from a repository's
+// short name to its app id while loading, for the caller to log
+func (c *Config) Notes() []string {
+	return c.notes
+}
+
+// migrateShortNames moves per-app settings keyed by a repository's short
+// name to its explicit app id, so adding an [apps] entry doesn't silently
+// drop the app's commands. Short names shared with another app are left
+// alone since it's unclear which app they were meant for. It returns a
+// note for every key moved.
+func (c *Config) migrateShortNames() []string {
+	owners := make(map[string]bool)
+	for repo := range c.RepoMap {
+		if apps, exists := c.Monorepos[repo]; exists {
+			for _, app := range apps {
+				owners[app.App] = true
+			}
+			continue
+		}
+		owners[c.AppID(repo)] = true
+	}
+
+	claims := make(map[string]int)
+	for repo := range c.Apps {
+		claims[shortName(repo)]++
+	}
+
+	var notes []string
+	for _, repo := range sortedKeys(c.Apps) {
+		app, short := c.Apps[repo], shortName(repo)
+		if app == short || owners[short] || claims[short] > 1 {
+			continue
+		}
+
+		renamed := []struct {
+			table string
+			moved bool
+		}{
+			{"commands", renameKey(c.Commands, short, app)},
+			{"pipelines", renameKey(c.Pipelines, short, app)},
+			{"rollback_commands", renameKey(c.RollbackCommands, short, app)},
+			{"environments", renameKey(c.Environments, short, app)},
+			{"triggers", renameKey(c.Triggers, short, app)},
+			{"previews", renameKey(c.Previews, short, app)},
+			{"checks", renameKey(c.Checks, short, app)},
+			{"generic_hooks", renameKey(c.GenericHooks, short, app)},
+		}
+		for _, r := range renamed {
+			if r.moved {
+				notes = append(notes, fmt.Sprintf("[%s] %q applies to app %s (%s); please rename the key", r.table, short, app, repo))
+			}
+		}
+	}
+	return notes
+}
+
+// renameKey moves the value of from to to, unless to is already set
+func renameKey[V any](m map[string]V, from, to string) bool {
+	value, exists := m[from]
+	if !exists {
+		return false
+	}
+	if _, taken := m[to]; taken {
+		return false
+	}
+	m[to] = value
+	delete(m, from)
+	return true
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// secretKeys are settings whose values never appear in a diff
+var secretKeys = map[string]bool{
+	"webhook_secret":   true,
+	"api_key":          true,
+	"gitlab_token":     true,
+	"gitea_secret":     true,
+	"bitbucket_secret": true,
+}
+
+// restartKeys are settings only read at startup
+var restartKeys = map[string]bool{
+	"port":                     true,
+	"log_file":                 true,
+	"concurrency_limit":        true,
+	"history_file":             true,
+	"history_retention_days":   true,
+	"history_max_entries":      true,
+	"history_max_output_bytes": true,
+	"audit_file":               true,
+	"delivery_file":            true,
+	"delivery_window":          true,
+}
+
+// Diff describes what changed between two configurations, one line per
+// setting, or per key for tables such as [commands]. Secret values and
+// table contents are never included.
+func Diff(previous, current *Config) []string {
+	var changes []string
+
+	oldValue, newValue := reflect.ValueOf(previous).Elem(), reflect.ValueOf(current).Elem()
+	for _, s := range settings() {
+		before, after := oldValue.Field(s.index), newValue.Field(s.index)
+		if reflect.DeepEqual(before.Interface(), after.Interface()) {
+			continue
+		}
+
+		var change string
+		switch {
+		case before.Kind() == reflect.Map:
+			changes = append(changes, diffTable(s.key, before, after)...)
+			continue
+		case secretKeys[s.key]:
+			change = s.key + " changed"
+		default:
+			change = fmt.Sprintf("%s: %v -> %v", s.key, before.Interface(), after.Interface())
+		}
+		if restartKeys[s.key] {
+			change += " (takes effect after a restart)"
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// diffTable lists the keys added, removed or changed in a table
+func diffTable(table string, before, after reflect.Value) []string {
+	keys := make(map[string]bool)
+	for _, key := range before.MapKeys() {
+		keys[key.String()] = true
+	}
+	for _, key := range after.MapKeys() {
+		keys[key.String()] = true
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	var changes []string
+	for _, key := range sorted {
+		oldEntry := before.MapIndex(reflect.ValueOf(key))
+		newEntry := after.MapIndex(reflect.ValueOf(key))
+		switch {
+		case !oldEntry.IsValid():
+			changes = append(changes, fmt.Sprintf("%s: added %q", table, key))
+		case !newEntry.IsValid():
+			changes = append(changes, fmt.Sprintf("%s: removed %q", table, key))
+		case !reflect.DeepEqual(oldEntry.Interface(), newEntry.Interface()):
+			changes = append(changes, fmt.Sprintf("%s: changed %q", table, key))
+		}
+	}
+	return changes
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// envPrefix starts the environment variables that override config keys:
+// CICD_ followed by the key in upper case, e.g. CICD_PORT or
+// CICD_WEBHOOK_SECRET_FILE. CICD_CONFIG names the config file itself.
+const envPrefix = "CICD_"
+
+// Where a value came from, weakest first
+const (
+	sourceDefault = iota
+	sourceFile
+	sourceEnv
+)
+
+// setting is a config key and the index of its field in Config
+type setting struct {
+	key   string
+	index int
+}
+
+// settings lists the config keys in the order they are declared
+func settings() []setting {
+	var list []setting
+	fields := reflect.TypeOf(Config{})
+	for i := 0; i < fields.NumField(); i++ {
+		key, _, _ := strings.Cut(fields.Field(i).Tag.Get("toml"), ",")
+		if key != "" && key != "-" {
+			list = append(list, setting{key: key, index: i})
+		}
+	}
+	return list
+}
+
+// applyOverrides applies CICD_* environment variables on top of the values
+// decoded from the config file, then reads secret files. It records where
+// each key's value came from.
+func (c *Config) applyOverrides(meta toml.MetaData) error {
+	c.sources = make(map[string]string)
+	ranks := make(map[string]int)
+	indexes := make(map[string]int)
+	fields := reflect.ValueOf(c).Elem()
+
+	for _, s := range settings() {
+		indexes[s.key] = s.index
+		c.sources[s.key], ranks[s.key] = "default", sourceDefault
+		if meta.IsDefined(s.key) {
+			c.sources[s.key], ranks[s.key] = "config file", sourceFile
+		}
+
+		name := envPrefix + strings.ToUpper(s.key)
+		raw, set := os.LookupEnv(name)
+		if !set {
+			continue
+		}
+		if err := setFromEnv(fields, s, raw); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		c.sources[s.key], ranks[s.key] = "env "+name, sourceEnv
+	}
+
+	// A secret file wins over a plain value from the same or a weaker source
+	for key := range secretKeys {
+		fileKey := key + "_file"
+		path := fields.Field(indexes[fileKey]).String()
+		if path == "" || ranks[fileKey] < ranks[key] {
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fileKey, err)
+		}
+		fields.Field(indexes[key]).SetString(strings.TrimRight(string(content), "\r\n"))
+		c.sources[key] = fmt.Sprintf("file %s via %s", path, c.sources[fileKey])
+	}
+	return nil
+}
+
+// setFromEnv parses an environment variable into a config field. Strings
+// are taken as they are; other values are written in TOML syntax, e.g.
+// CICD_DRY_RUN=true or CICD_REPOSITORIES='{ "acme/api" = "/opt/api" }'.
+// Lists of strings may also be given comma-separated.
+func setFromEnv(fields reflect.Value, s setting, raw string) error {
+	field := fields.Field(s.index)
+	if field.Kind() == reflect.String {
+		field.SetString(raw)
+		return nil
+	}
+
+	var parsed Config
+	if _, err := toml.Decode(s.key+" = "+raw, &parsed); err != nil {
+		if field.Type() != reflect.TypeOf([]string(nil)) {
+			return fmt.Errorf("invalid value %q: %w", raw, err)
+		}
+		var list []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+		return nil
+	}
+	field.Set(reflect.ValueOf(parsed).Field(s.index))
+	return nil
+}
+
+// Describe lists every key with its value and where the value came from,
+// with secrets redacted and tables summarized
+func (c *Config) Describe() []string {
+	fields := reflect.ValueOf(c).Elem()
+
+	var lines []string
+	for _, s := range settings() {
+		field := fields.Field(s.index)
+
+		var value string
+		switch {
+		case secretKeys[s.key] && field.String() != "":
+			value = "[redacted]"
+		case field.Kind() == reflect.Map:
+			value = fmt.Sprintf("%d entries", field.Len())
+		case field.Kind() == reflect.String:
+			value = fmt.Sprintf("%q", field.String())
+		default:
+			value = fmt.Sprintf("%v", field.Interface())
+		}
+
+		source := c.sources[s.key]
+		if source == "" {
+			source = "default"
+		}
+		lines = append(lines, fmt.Sprintf("%s = %s (%s)", s.key, value, source))
+	}
+	return lines
+}
@@ -0,0 +1,149 @@
+package deployment
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// defaultChecksTimeout is how long a request waits for CI when the app's
+// check gate doesn't say otherwise
+const defaultChecksTimeout = 60 * time.Minute
+
+// heldRequest is a request parked until CI reports on its commit
+type heldRequest struct {
+	request *Request
+	timer   *time.Timer
+	passed  map[string]bool // workflows that passed so far
+}
+
+// Hold registers a deployment request that only runs once ReleaseChecks
+// reports passing checks for its commit. A newer request for the same lock
+// key supersedes one still waiting.
+func (e *Executor) Hold(req *Request) error {
+	if req.ID == "" {
+		req.ID = generateID()
+	}
+
+	// Fail now rather than after CI passed
+	e.accept(req)
+	if err := e.prepareCommands(req); err != nil {
+		return fmt.Errorf("failed to prepare commands: %w", err)
+	}
+
+	req.QueuedAt = time.Now()
+	req.HeldForChecks = true
+	e.track(req, StatusPendingChecks)
+
+	key := e.lockKey(req)
+	timeout := defaultChecksTimeout
+	if minutes := e.configFor(req).Checks[e.appName(req)].TimeoutMinutes; minutes > 0 {
+		timeout = time.Duration(minutes) * time.Minute
+	}
+
+	e.lockMutex.Lock()
+	var previous *Request
+	for id, h := range e.held {
+		if e.lockKey(h.request) == key {
+			h.timer.Stop()
+			delete(e.held, id)
+			previous = h.request
+		}
+	}
+	e.held[req.ID] = &heldRequest{
+		request: req,
+		passed:  make(map[string]bool),
+		timer: time.AfterFunc(timeout, func() {
+			if held := e.unhold(req.ID); held != nil {
+				e.finishWithoutRunning(held, StatusChecksFailed, fmt.Sprintf("No passing checks within %v", timeout))
+			}
+		}),
+	}
+	e.lockMutex.Unlock()
+
+	if previous != nil {
+		e.supersede(previous, req)
+	}
+	return nil
+}
+
+// ReleaseChecks reports a finished CI run for a commit. A held request for
+// it is dropped as CHECKS_FAILED as soon as one of the workflows its app's
+// check gate lists fails, and queued once every one of them has passed.
+// Runs the gate doesn't list are ignored. It returns the requests released
+// and dropped, and the number still waiting for other workflows.
+func (e *Executor) ReleaseChecks(repository, commit, name string, passed bool) (released, dropped []*Request, waiting int) {
+	e.lockMutex.Lock()
+	var failed, matched []*Request
+	for id, h := range e.held {
+		req := h.request
+		if req.Repository != repository || req.Commit != commit {
+			continue
+		}
+		workflows := e.configFor(req).Checks[e.appName(req)].Workflows
+		if !slices.Contains(workflows, name) {
+			continue
+		}
+		if passed {
+			h.passed[name] = true
+			if len(h.passed) < len(workflows) {
+				waiting++
+				continue
+			}
+		}
+		h.timer.Stop()
+		delete(e.held, id)
+		if passed {
+			matched = append(matched, req)
+		} else {
+			failed = append(failed, req)
+		}
+	}
+	e.lockMutex.Unlock()
+
+	for _, req := range failed {
+		e.finishWithoutRunning(req, StatusChecksFailed, fmt.Sprintf("Check %s failed", name))
+	}
+	for _, req := range matched {
+		req.ChecksPassedAt = time.Now()
+		e.activeMutex.Lock()
+		if t, exists := e.active[req.ID]; exists {
+			t.status = StatusQueued
+		}
+		e.activeMutex.Unlock()
+
+		// A full queue is reported as a failed deployment by schedule
+		e.schedule(req)
+	}
+	return matched, failed, waiting
+}
+
+// unhold removes a request from the holding area, returning nil if it
+// wasn't held
+func (e *Executor) unhold(id string) *Request {
+	e.lockMutex.Lock()
+	defer e.lockMutex.Unlock()
+
+	h, exists := e.held[id]
+	if !exists {
+		return nil
+	}
+	h.timer.Stop()
+	delete(e.held, id)
+	return h.request
+}
+
+// finishWithoutRunning reports a request that never got to run
+func (e *Executor) finishWithoutRunning(req *Request, status Status, message string) {
+	now := time.Now()
+	result := &Result{
+		Request:   req,
+		Status:    status,
+		StartTime: now,
+		EndTime:   now,
+		Error:     message,
+	}
+	result.recordEvent(status, message)
+	e.untrack(req.ID, status)
+	e.sendResult(result)
+}
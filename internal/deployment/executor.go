@@ -2,36 +2,61 @@ package deployment
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ktappdev/cicd-thing/internal/config"
 	"github.com/ktappdev/cicd-thing/internal/mapping"
 )
 
+// ErrDeploymentNotFound is returned when a deployment is neither queued nor running
+var ErrDeploymentNotFound = errors.New("deployment not found")
+
 // Executor handles deployment execution
 type Executor struct {
-	config    *config.Config
-	mapper    *mapping.Mapper
-	locks     map[string]*Lock
-	lockMutex sync.RWMutex
-	queue     chan *Request
-	results   chan *Result
+	config      atomic.Pointer[config.Config]
+	locks       map[string]*Lock
+	inflight    map[string]string       // lock key -> ID of its queued or running request
+	pending     map[string]*Request     // lock key -> latest request waiting for it to finish
+	held        map[string]*heldRequest // request ID -> request waiting for CI checks
+	lockMutex   sync.RWMutex
+	active      map[string]*tracked
+	waiters     map[string][]chan *Result
+	activeMutex sync.Mutex
+	queue       chan *Request
+	results     chan *Result
+}
+
+// tracked holds the live state of a queued or running deployment
+type tracked struct {
+	request   *Request
+	status    Status
+	startTime time.Time
+	cancel    context.CancelFunc
+	cancelled bool
+	output    *OutputBuffer
 }
 
 // New creates a new deployment executor
 func New(cfg *config.Config) *Executor {
 	executor := &Executor{
-		config:  cfg,
-		mapper:  mapping.New(cfg),
-		locks:   make(map[string]*Lock),
-		queue:   make(chan *Request, 100), // Buffer for queued deployments
-		results: make(chan *Result, 100),  // Buffer for results
+		locks:    make(map[string]*Lock),
+		inflight: make(map[string]string),
+		pending:  make(map[string]*Request),
+		held:     make(map[string]*heldRequest),
+		active:   make(map[string]*tracked),
+		waiters:  make(map[string][]chan *Result),
+		queue:    make(chan *Request, 100), // Buffer for queued deployments
+		results:  make(chan *Result, 100),  // Buffer for results
 	}
+	executor.config.Store(cfg)
 
 	// Start worker goroutines
 	for i := 0; i < cfg.ConcurrencyLimit; i++ {
@@ -41,32 +66,178 @@ func New(cfg *config.Config) *Executor {
 	return executor
 }
 
-// Deploy queues a deployment request
-func (e *Executor) Deploy(req *Request) error {
-	appName := e.mapper.GetAppName(req.Repository)
-
-	// Check if app is locked
-	if e.isLocked(appName) {
-		return fmt.Errorf("deployment already in progress for app %s", appName)
-	}
+// Reload switches the executor to a new configuration. Requests already
+// queued, held or running keep the configuration they were accepted under;
+// the number of workers is fixed at startup.
+func (e *Executor) Reload(cfg *config.Config) {
+	e.config.Store(cfg)
+}
 
+// Deploy queues a deployment request. If the app already has a deployment
+// queued or running, the request takes the app's pending slot instead and
+// runs once that deployment finishes; whatever was pending before is
+// superseded ("latest push wins").
+func (e *Executor) Deploy(req *Request) error {
 	// Generate unique ID if not provided
 	if req.ID == "" {
 		req.ID = generateID()
 	}
 
 	// Prepare commands
+	e.accept(req)
 	if err := e.prepareCommands(req); err != nil {
 		return fmt.Errorf("failed to prepare commands: %w", err)
 	}
 
+	req.QueuedAt = time.Now()
+	e.track(req, StatusQueued)
+
+	return e.schedule(req)
+}
+
+// schedule queues a tracked request, or parks it in its lock key's pending
+// slot while another deployment for the same key is queued or running.
+// A request that can't be queued is reported as failed, like any other
+// deployment that never got to run, and the error is returned as well.
+func (e *Executor) schedule(req *Request) error {
+	key := e.lockKey(req)
+
+	e.lockMutex.Lock()
+	if _, busy := e.inflight[key]; busy {
+		previous := e.pending[key]
+		e.pending[key] = req
+		e.lockMutex.Unlock()
+
+		if previous != nil {
+			e.supersede(previous, req)
+		}
+		return nil
+	}
+	e.inflight[key] = req.ID
+	e.lockMutex.Unlock()
+
 	// Queue the deployment
+	if err := e.enqueue(req); err != nil {
+		e.finishWithoutRunning(req, StatusFailed, err.Error())
+		// A request parked for the key in the meantime would otherwise
+		// wait for a deployment that never runs
+		e.startPending(key)
+		return err
+	}
+	return nil
+}
+
+// Skip records a request that was deliberately not deployed, e.g. because
+// of a [skip deploy] commit directive, so the history shows why nothing ran
+func (e *Executor) Skip(req *Request, reason string) {
+	if req.ID == "" {
+		req.ID = generateID()
+	}
+	e.accept(req)
+	req.App = e.appName(req)
+	req.QueuedAt = time.Now()
+	e.finishWithoutRunning(req, StatusSkipped, reason)
+}
+
+// DeployAndWait queues a deployment request and blocks until it reaches a
+// final status or ctx ends
+func (e *Executor) DeployAndWait(ctx context.Context, req *Request) (*Result, error) {
+	if req.ID == "" {
+		req.ID = generateID()
+	}
+
+	// Register before queueing so a fast deployment can't finish unseen
+	done := make(chan *Result, 1)
+	e.activeMutex.Lock()
+	e.waiters[req.ID] = append(e.waiters[req.ID], done)
+	e.activeMutex.Unlock()
+	defer e.removeWaiter(req.ID, done)
+
+	if err := e.Deploy(req); err != nil {
+		return nil, err
+	}
+
 	select {
-	case e.queue <- req:
-		return nil
-	default:
-		return fmt.Errorf("deployment queue is full")
+	case result := <-done:
+		return result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// removeWaiter unregisters a DeployAndWait caller
+func (e *Executor) removeWaiter(id string, done chan *Result) {
+	e.activeMutex.Lock()
+	defer e.activeMutex.Unlock()
+
+	waiters := e.waiters[id]
+	for i, ch := range waiters {
+		if ch == done {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(e.waiters, id)
+	} else {
+		e.waiters[id] = waiters
+	}
+}
+
+// List returns all queued and running deployments, oldest first
+func (e *Executor) List() []*Deployment {
+	e.activeMutex.Lock()
+	defer e.activeMutex.Unlock()
+
+	deployments := make([]*Deployment, 0, len(e.active))
+	for _, t := range e.active {
+		deployments = append(deployments, t.snapshot())
 	}
+	sort.Slice(deployments, func(i, j int) bool {
+		return deployments[i].QueuedAt.Before(deployments[j].QueuedAt)
+	})
+	return deployments
+}
+
+// Get returns a queued or running deployment by ID
+func (e *Executor) Get(id string) (*Deployment, bool) {
+	e.activeMutex.Lock()
+	defer e.activeMutex.Unlock()
+
+	t, exists := e.active[id]
+	if !exists {
+		return nil, false
+	}
+	return t.snapshot(), true
+}
+
+// Stream returns the live output buffer of a queued or running deployment
+func (e *Executor) Stream(id string) (*OutputBuffer, bool) {
+	buffer := e.outputBuffer(id)
+	return buffer, buffer != nil
+}
+
+// Cancel stops a queued or running deployment. A running deployment has its
+// whole process group killed; a queued one is dropped when a worker reaches it.
+func (e *Executor) Cancel(id string) error {
+	e.activeMutex.Lock()
+	t, exists := e.active[id]
+	if !exists {
+		e.activeMutex.Unlock()
+		return ErrDeploymentNotFound
+	}
+
+	t.cancelled = true
+	if t.cancel != nil {
+		t.cancel()
+	}
+	e.activeMutex.Unlock()
+
+	// A request waiting for checks is in no queue, so finish it right away
+	if req := e.unhold(id); req != nil {
+		e.finishWithoutRunning(req, StatusCancelled, "Deployment cancelled while waiting for checks")
+	}
+	return nil
 }
 
 // GetResults returns the results channel
@@ -76,39 +247,128 @@ func (e *Executor) GetResults() <-chan *Result {
 
 // GetLocalPath returns the local path for a repository
 func (e *Executor) GetLocalPath(repository string) (string, error) {
-	return e.mapper.GetLocalPath(repository)
+	return mapping.New(e.config.Load()).GetLocalPath(repository)
+}
+
+// GetApps returns the apps deployed from a repository
+func (e *Executor) GetApps(repository string) []string {
+	return mapping.New(e.config.Load()).GetApps(repository)
+}
+
+// ResolveEnvironment returns the environment a branch of an app deploys to
+// ("" if the app has none) and its local path
+func (e *Executor) ResolveEnvironment(repository, appName, branch string) (string, string, error) {
+	mapper := mapping.New(e.config.Load())
+	env, err := mapper.ResolveEnvironment(appName, branch)
+	if err != nil {
+		return "", "", err
+	}
+
+	localPath, err := mapper.GetEnvironmentPath(repository, appName, env)
+	if err != nil || env == nil {
+		return "", localPath, err
+	}
+	return env.Name, localPath, nil
 }
 
 // worker processes deployment requests from the queue
 func (e *Executor) worker() {
 	for req := range e.queue {
 		result := e.executeDeployment(req)
+		e.untrack(req.ID, result.Status)
+		e.sendResult(result)
+		e.startPending(e.lockKey(req))
+	}
+}
+
+// enqueue puts a request on the worker queue
+func (e *Executor) enqueue(req *Request) error {
+	select {
+	case e.queue <- req:
+		return nil
+	default:
+		return fmt.Errorf("deployment queue is full")
+	}
+}
+
+// sendResult hands a finished deployment to the results channel and to
+// anyone waiting on it
+func (e *Executor) sendResult(result *Result) {
+	e.activeMutex.Lock()
+	for _, done := range e.waiters[result.Request.ID] {
+		done <- result
+	}
+	delete(e.waiters, result.Request.ID)
+	e.activeMutex.Unlock()
+
+	select {
+	case e.results <- result:
+	default:
+		// Results channel is full, log error
+		fmt.Printf("Results channel full, dropping result for %s\n", result.Request.ID)
+	}
+}
+
+// startPending frees the key's slot and queues its pending request, if any
+func (e *Executor) startPending(key string) {
+	e.lockMutex.Lock()
+	next := e.pending[key]
+	delete(e.pending, key)
+	if next == nil {
+		delete(e.inflight, key)
+		e.lockMutex.Unlock()
+		return
+	}
+	e.inflight[key] = next.ID
+	e.lockMutex.Unlock()
 
-		// Send result to results channel
-		select {
-		case e.results <- result:
-		default:
-			// Results channel is full, log error
-			fmt.Printf("Results channel full, dropping result for %s\n", req.ID)
+	if err := e.enqueue(next); err != nil {
+		result := &Result{
+			Request:   next,
+			Status:    StatusFailed,
+			StartTime: time.Now(),
+			EndTime:   time.Now(),
+			Error:     err.Error(),
 		}
+		result.recordEvent(StatusFailed, result.Error)
+		e.untrack(next.ID, StatusFailed)
+		e.sendResult(result)
+		e.startPending(key)
+	}
+}
+
+// supersede records that a pending request was replaced by a newer one
+func (e *Executor) supersede(old, replacement *Request) {
+	now := time.Now()
+	result := &Result{
+		Request:      old,
+		Status:       StatusSuperseded,
+		StartTime:    now,
+		EndTime:      now,
+		SupersededBy: replacement.ID,
 	}
+	result.recordEvent(StatusSuperseded, "Superseded by "+replacement.ID)
+	e.untrack(old.ID, StatusSuperseded)
+	e.sendResult(result)
 }
 
 // executeDeployment executes a single deployment
 func (e *Executor) executeDeployment(req *Request) *Result {
-	appName := e.mapper.GetAppName(req.Repository)
+	key := e.lockKey(req)
 
 	// Acquire lock
-	if !e.acquireLock(appName, req.ID) {
-		return &Result{
+	if !e.acquireLock(key, req.ID) {
+		result := &Result{
 			Request:   req,
 			Status:    StatusFailed,
 			StartTime: time.Now(),
 			EndTime:   time.Now(),
 			Error:     "Failed to acquire deployment lock",
 		}
+		result.recordEvent(StatusFailed, result.Error)
+		return result
 	}
-	defer e.releaseLock(appName)
+	defer e.releaseLock(key)
 
 	result := &Result{
 		Request:   req,
@@ -116,11 +376,24 @@ func (e *Executor) executeDeployment(req *Request) *Result {
 		StartTime: time.Now(),
 	}
 
-	// Execute deployment with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), e.config.Timeout)
+	// Execute deployment with timeout; the cancel func lets Cancel stop it early
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if e.config.DryRun {
+	if !e.markStarted(req.ID, cancel) {
+		result.Status = StatusCancelled
+		result.Error = "Deployment cancelled before it started"
+		result.EndTime = time.Now()
+		result.recordEvent(result.Status, result.Error)
+		return result
+	}
+	result.recordEvent(StatusStarted, "Deployment started")
+
+	cfg := e.configFor(req)
+	ctx, timeoutCancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer timeoutCancel()
+
+	if cfg.DryRun {
 		result.Status = StatusSuccess
 		result.Output = "DRY RUN: Commands would be executed"
 	} else {
@@ -129,90 +402,345 @@ func (e *Executor) executeDeployment(req *Request) *Result {
 
 	result.EndTime = time.Now()
 	result.Duration = result.EndTime.Sub(result.StartTime)
+	result.recordEvent(result.Status, result.Error)
 
 	return result
 }
 
-// runCommands executes the deployment commands
+// runCommands executes the deployment pipeline, streaming its output line
+// by line into the deployment's output buffer
 func (e *Executor) runCommands(ctx context.Context, req *Request, result *Result) *Result {
 	var output strings.Builder
+	writer := &outputWriter{full: &output, stream: e.outputBuffer(req.ID)}
+
+	// Pin the working tree to the requested commit before running anything.
+	// Previews always need a checkout; a teardown only needs the directory.
+	if req.Teardown {
+		if _, err := os.Stat(req.LocalPath); os.IsNotExist(err) {
+			writer.Write([]byte("Preview directory already removed\n"))
+			result.Status = StatusSuccess
+			result.Output = output.String()
+			return result
+		}
+	} else if e.configFor(req).GitCheckout || req.PullRequest > 0 {
+		fmt.Fprintf(writer, "Checkout: %s\n", req.Commit)
+		checkout := checkoutCommit
+		if req.PullRequest > 0 {
+			checkout = e.checkoutPreview
+		}
+		sha, err := checkout(ctx, req, writer)
+		writer.Flush()
+		writer.Write([]byte("\n"))
 
-	for i, command := range req.Commands {
-		select {
-		case <-ctx.Done():
-			result.Status = StatusTimeout
-			result.Error = "Deployment timed out"
+		if err != nil {
+			if ctx.Err() != nil {
+				setContextStatus(ctx, result)
+			} else {
+				result.Status = StatusFailed
+				result.Error = fmt.Sprintf("Checkout failed: %v", err)
+			}
+			result.Output = output.String()
 			return result
-		default:
+		}
+		result.ResolvedCommit = sha
+	}
+
+	blocked := false
+	for i, step := range req.Steps {
+		fmt.Fprintf(writer, "Step %d [%s]: %s\n", i+1, step.Name, step.Command)
+
+		// Once a step fails (or the deployment timed out) only always_run
+		// steps still execute; a cancelled deployment runs nothing more
+		deploymentDone := ctx.Err() != nil
+		cancelled := deploymentDone && !errors.Is(ctx.Err(), context.DeadlineExceeded)
+		if cancelled || ((blocked || deploymentDone) && !step.AlwaysRun) {
+			writer.Write([]byte("skipped\n\n"))
+			result.Steps = append(result.Steps, StepResult{
+				Name:    step.Name,
+				Command: step.Command,
+				Status:  StatusSkipped,
+			})
+			continue
 		}
 
-		// Execute command
-		cmd := exec.CommandContext(ctx, "sh", "-c", command)
-		cmd.Dir = req.LocalPath
-		cmd.Env = os.Environ()
+		stepCtx, stepCancel := ctx, context.CancelFunc(func() {})
+		if deploymentDone {
+			// Give cleanup steps their own budget after a deployment timeout
+			stepCtx, stepCancel = context.WithTimeout(context.Background(), e.configFor(req).Timeout)
+		}
+		stepResult := e.runStep(stepCtx, req, step, writer)
+		stepCancel()
+		writer.Write([]byte("\n"))
 
-		cmdOutput, err := cmd.CombinedOutput()
-		output.WriteString(fmt.Sprintf("Command %d: %s\n", i+1, command))
-		output.WriteString(string(cmdOutput))
-		output.WriteString("\n")
+		result.Steps = append(result.Steps, stepResult)
 
-		if err != nil {
-			result.Status = StatusFailed
-			result.Error = fmt.Sprintf("Command failed: %s - %v", command, err)
-			result.ExitCode = cmd.ProcessState.ExitCode()
-			result.Output = output.String()
+		if stepResult.Status != StatusSuccess && !step.ContinueOnError && !blocked {
+			blocked = true
+			result.Error = stepResult.Error
+			result.ExitCode = stepResult.ExitCode
+		}
+	}
 
-			// Attempt rollback if configured
-			if e.shouldRollback(req.Repository) {
-				e.performRollback(req, result)
+	// Tear down even if a teardown step failed, a closed PR shouldn't
+	// leave its preview behind; only an explicit cancel keeps it
+	if req.Teardown && !(ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded)) {
+		if err := e.removePreview(req); err != nil {
+			fmt.Fprintf(writer, "Failed to remove preview directory: %v\n", err)
+			if !blocked {
+				blocked = true
+				result.Error = fmt.Sprintf("Failed to remove preview directory: %v", err)
 			}
+		} else {
+			fmt.Fprintf(writer, "Removed preview directory %s\n", req.LocalPath)
+		}
+	}
 
-			return result
+	result.Output = output.String()
+
+	if ctx.Err() != nil {
+		setContextStatus(ctx, result)
+
+		// A cancelled deployment was stopped on purpose, so leave it as is
+		if result.Status == StatusTimeout && e.shouldRollback(req) {
+			e.performRollback(req, result)
+		}
+		return result
+	}
+
+	if blocked {
+		result.Status = StatusFailed
+
+		// Attempt rollback if configured
+		if e.shouldRollback(req) {
+			e.performRollback(req, result)
 		}
+		return result
 	}
 
 	result.Status = StatusSuccess
-	result.Output = output.String()
 	return result
 }
 
-// prepareCommands prepares the commands for deployment
+// exitCode returns the exit code of a finished command, or -1 if it never ran
+func exitCode(cmd *exec.Cmd) int {
+	if cmd.ProcessState == nil {
+		return -1
+	}
+	return cmd.ProcessState.ExitCode()
+}
+
+// setContextStatus marks the result as timed out or cancelled depending on
+// why the deployment context ended
+func setContextStatus(ctx context.Context, result *Result) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		result.Status = StatusTimeout
+		result.Error = "Deployment timed out"
+		return
+	}
+	result.Status = StatusCancelled
+	result.Error = "Deployment cancelled"
+}
+
+// newCommand builds a command that runs in dir and is killed, along with
+// any children, when ctx ends
+func newCommand(ctx context.Context, dir, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	cmd.WaitDelay = 5 * time.Second
+	setProcessGroup(cmd)
+	return cmd
+}
+
+// Plan fills in the pipeline a request would run under cfg without
+// queueing it, e.g. for "cicd-thing validate --explain". It returns the
+// command that would roll the deployment back, if any.
+func Plan(cfg *config.Config, req *Request) (string, error) {
+	e := &Executor{}
+	e.config.Store(cfg)
+	e.accept(req)
+	if err := e.prepareCommands(req); err != nil {
+		return "", err
+	}
+	if !e.shouldRollback(req) {
+		return "", nil
+	}
+	rollback, _ := e.rollbackCommand(req)
+	return rollback, nil
+}
+
+// prepareCommands prepares the pipeline steps for deployment
 func (e *Executor) prepareCommands(req *Request) error {
-	appName := e.mapper.GetAppName(req.Repository)
+	cfg := e.configFor(req)
+	appName := e.appName(req)
+	req.App = appName
+
+	previewSteps, isPreview, err := e.previewSteps(req, appName)
+	if err != nil {
+		return err
+	}
 
-	// Check for app-specific commands
-	if commands, exists := e.config.Commands[appName]; exists {
-		req.Commands = parseCommands(commands)
-	} else if e.config.DefaultCommands != "" {
+	// Previews and environments may bring their own pipeline; otherwise
+	// structured pipelines win over the command string shorthand
+	env, hasEnv := mapping.New(cfg).GetEnvironment(appName, req.Environment)
+	if isPreview {
+		req.Steps = previewSteps
+	} else if hasEnv && len(env.Steps) > 0 {
+		steps, err := stepsFromConfig(env.Steps)
+		if err != nil {
+			return fmt.Errorf("invalid pipeline for environment %s of app %s: %w", env.Name, appName, err)
+		}
+		req.Steps = steps
+	} else if hasEnv && env.Commands != "" {
+		req.Steps = stepsFromString(env.Commands)
+	} else if pipeline, exists := cfg.Pipelines[appName]; exists {
+		steps, err := stepsFromConfig(pipeline)
+		if err != nil {
+			return fmt.Errorf("invalid pipeline for app %s: %w", appName, err)
+		}
+		req.Steps = steps
+	} else if commands, exists := cfg.Commands[appName]; exists {
+		req.Steps = stepsFromString(commands)
+	} else if cfg.DefaultCommands != "" {
 		// Use default commands and replace placeholder
-		defaultCmd := strings.ReplaceAll(e.config.DefaultCommands, "appname", appName)
-		req.Commands = parseCommands(defaultCmd)
+		defaultCmd := strings.ReplaceAll(cfg.DefaultCommands, "appname", appName)
+		req.Steps = stepsFromString(defaultCmd)
 	} else {
 		return fmt.Errorf("no commands configured for app %s", appName)
 	}
 
+	// The checkout phase already put the tree on the right commit; a
+	// following "git pull" would move it to whatever the branch tip is now
+	if cfg.GitCheckout || req.PullRequest > 0 {
+		req.Steps = withoutGitPull(req.Steps)
+	}
+
 	return nil
 }
 
-// parseCommands splits a command string into individual commands
-func parseCommands(commandStr string) []string {
-	// Split by && for now, could be enhanced to handle more complex cases
-	commands := strings.Split(commandStr, "&&")
-	var result []string
-	for _, cmd := range commands {
-		if trimmed := strings.TrimSpace(cmd); trimmed != "" {
-			result = append(result, trimmed)
+// withoutGitPull drops bare "git pull" steps from a pipeline
+func withoutGitPull(steps []Step) []Step {
+	var result []Step
+	for _, step := range steps {
+		if strings.Join(strings.Fields(step.Command), " ") == "git pull" {
+			continue
 		}
+		result = append(result, step)
 	}
 	return result
 }
 
-// isLocked checks if an app is currently locked
-func (e *Executor) isLocked(appName string) bool {
-	e.lockMutex.RLock()
-	defer e.lockMutex.RUnlock()
-	_, exists := e.locks[appName]
-	return exists
+// track registers a request as queued or waiting for checks
+func (e *Executor) track(req *Request, status Status) {
+	e.activeMutex.Lock()
+	defer e.activeMutex.Unlock()
+	e.active[req.ID] = &tracked{
+		request: req,
+		status:  status,
+		output:  NewOutputBuffer(outputBufferLines),
+	}
+}
+
+// untrack removes a finished request and ends its output stream
+func (e *Executor) untrack(id string, status Status) {
+	e.activeMutex.Lock()
+	defer e.activeMutex.Unlock()
+	if t, exists := e.active[id]; exists {
+		t.output.Close(status)
+		delete(e.active, id)
+	}
+}
+
+// outputBuffer returns the live output buffer of a tracked request, or nil
+func (e *Executor) outputBuffer(id string) *OutputBuffer {
+	e.activeMutex.Lock()
+	defer e.activeMutex.Unlock()
+	if t, exists := e.active[id]; exists {
+		return t.output
+	}
+	return nil
+}
+
+// markStarted moves a tracked request to running and stores its cancel func.
+// It returns false if the request was cancelled while still queued.
+func (e *Executor) markStarted(id string, cancel context.CancelFunc) bool {
+	e.activeMutex.Lock()
+	defer e.activeMutex.Unlock()
+
+	t, exists := e.active[id]
+	if !exists {
+		return true
+	}
+	if t.cancelled {
+		return false
+	}
+	t.status = StatusStarted
+	t.startTime = time.Now()
+	t.cancel = cancel
+	return true
+}
+
+// snapshot returns a copy of the tracked state safe to hand out
+func (t *tracked) snapshot() *Deployment {
+	return &Deployment{
+		ID:          t.request.ID,
+		Repository:  t.request.Repository,
+		App:         t.request.App,
+		Branch:      t.request.Branch,
+		Environment: t.request.Environment,
+		Tag:         t.request.Tag,
+		PullRequest: t.request.PullRequest,
+		Teardown:    t.request.Teardown,
+		Commit:      t.request.Commit,
+		Author:      t.request.Author,
+		Manual:      t.request.Manual,
+		Status:      t.status,
+		QueuedAt:    t.request.QueuedAt,
+		StartTime:   t.startTime,
+	}
+}
+
+// appName returns the app a request deploys
+func (e *Executor) appName(req *Request) string {
+	if req.App != "" {
+		return req.App
+	}
+	return e.mapperFor(req).GetAppName(req.Repository)
+}
+
+// accept binds a request to the current configuration
+func (e *Executor) accept(req *Request) {
+	if req.config == nil {
+		req.config = e.config.Load()
+	}
+}
+
+// configFor returns the configuration a request was accepted under, so a
+// reload never changes a deployment that is already on its way
+func (e *Executor) configFor(req *Request) *config.Config {
+	if req.config != nil {
+		return req.config
+	}
+	return e.config.Load()
+}
+
+// mapperFor returns a mapper over the configuration of a request
+func (e *Executor) mapperFor(req *Request) *mapping.Mapper {
+	return mapping.New(e.configFor(req))
+}
+
+// lockKey returns the key a request is serialized under. Environments of
+// an app deploy independently, and every pull request preview gets its own
+// key so previews never block production deployments, or each other.
+func (e *Executor) lockKey(req *Request) string {
+	appName := e.appName(req)
+	switch {
+	case req.PullRequest > 0:
+		return fmt.Sprintf("%s#pr-%d", appName, req.PullRequest)
+	case req.Environment != "":
+		return appName + "@" + req.Environment
+	}
+	return appName
 }
 
 // acquireLock attempts to acquire a lock for an app
@@ -239,35 +767,56 @@ func (e *Executor) releaseLock(appName string) {
 	delete(e.locks, appName)
 }
 
-// shouldRollback checks if rollback should be performed for a repository
-func (e *Executor) shouldRollback(repository string) bool {
-	appName := e.mapper.GetAppName(repository)
-	_, exists := e.config.RollbackCommands[appName]
+// shouldRollback checks if rollback should be performed for a request.
+// Previews have nothing to roll back to, and [no-rollback] opts out.
+func (e *Executor) shouldRollback(req *Request) bool {
+	if req.PullRequest > 0 || req.NoRollback {
+		return false
+	}
+	_, exists := e.rollbackCommand(req)
 	return exists
 }
 
+// rollbackCommand returns the rollback command of the request's environment,
+// falling back to the app's
+func (e *Executor) rollbackCommand(req *Request) (string, bool) {
+	if env, exists := e.mapperFor(req).GetEnvironment(e.appName(req), req.Environment); exists && env.Rollback != "" {
+		return env.Rollback, true
+	}
+	rollbackCmd, exists := e.configFor(req).RollbackCommands[e.appName(req)]
+	return rollbackCmd, exists
+}
+
 // performRollback performs rollback for a failed deployment
 func (e *Executor) performRollback(req *Request, result *Result) {
-	appName := e.mapper.GetAppName(req.Repository)
-	rollbackCmd, exists := e.config.RollbackCommands[appName]
+	rollbackCmd, exists := e.rollbackCommand(req)
 	if !exists {
 		return
 	}
 
 	// Execute rollback command
-	ctx, cancel := context.WithTimeout(context.Background(), e.config.Timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), e.configFor(req).Timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "sh", "-c", rollbackCmd)
-	cmd.Dir = req.LocalPath
-	cmd.Env = os.Environ()
+	var rollbackOutput strings.Builder
+	writer := &outputWriter{full: &rollbackOutput, stream: e.outputBuffer(req.ID)}
+
+	cmd := newCommand(ctx, req.LocalPath, "sh", "-c", rollbackCmd)
+	cmd.Env = append(cmd.Env, requestEnv(req)...)
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	result.recordEvent(result.Status, result.Error)
 
-	rollbackOutput, err := cmd.CombinedOutput()
+	writer.stream.WriteLine("Rollback: " + rollbackCmd)
+	err := cmd.Run()
+	writer.Flush()
 	if err != nil {
-		result.Error += fmt.Sprintf("\nRollback failed: %v\nRollback output: %s", err, string(rollbackOutput))
+		result.RollbackError = err.Error()
+		result.Error += fmt.Sprintf("\nRollback failed: %v\nRollback output: %s", err, rollbackOutput.String())
 	} else {
 		result.Status = StatusRollback
-		result.Output += fmt.Sprintf("\nRollback executed successfully:\n%s", string(rollbackOutput))
+		result.Output += fmt.Sprintf("\nRollback executed successfully:\n%s", rollbackOutput.String())
 	}
 }
 
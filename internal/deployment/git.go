@@ -0,0 +1,87 @@
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// shaPattern matches full or abbreviated commit SHAs
+var shaPattern = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// checkoutCommit fetches the repository and hard-checks-out the requested
+// commit so that exactly that revision is deployed. Request.Commit may be a
+// SHA, a tag or a ref; empty or "HEAD" means Request.Tag if set, otherwise
+// the tip of Request.Branch on origin. It returns the full SHA that HEAD points to afterwards.
+func checkoutCommit(ctx context.Context, req *Request, out io.Writer) (string, error) {
+	if _, err := runGit(ctx, req.LocalPath, out, "fetch", "--force", "--tags", "--prune", "origin"); err != nil {
+		return "", fmt.Errorf("git fetch failed: %w", err)
+	}
+
+	target := req.Commit
+	if req.Tag != "" && (target == "" || target == req.Tag) {
+		// Spell out the tag so a branch of the same name can't shadow it
+		target = "refs/tags/" + req.Tag
+	} else if target == "" || target == "HEAD" {
+		if req.Branch == "" {
+			return "", fmt.Errorf("no commit or branch to check out")
+		}
+		target = "origin/" + req.Branch
+	}
+
+	sha, err := resolveCommit(ctx, req.LocalPath, target)
+	if err != nil && shaPattern.MatchString(target) {
+		// Commits no longer reachable from a branch are not fetched by default
+		runGit(ctx, req.LocalPath, out, "fetch", "origin", target)
+		sha, err = resolveCommit(ctx, req.LocalPath, target)
+	}
+	if err != nil && !shaPattern.MatchString(target) {
+		// Plain branch names only exist as remote-tracking refs
+		sha, err = resolveCommit(ctx, req.LocalPath, "origin/"+target)
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve %s to a commit", target)
+	}
+
+	args := []string{"checkout", "--force", "--detach", sha}
+	if req.Branch != "" {
+		args = []string{"checkout", "--force", "-B", req.Branch, sha}
+	}
+	if _, err := runGit(ctx, req.LocalPath, out, args...); err != nil {
+		return "", fmt.Errorf("git checkout failed: %w", err)
+	}
+
+	head, err := resolveCommit(ctx, req.LocalPath, "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("cannot verify HEAD: %w", err)
+	}
+	if head != sha {
+		return "", fmt.Errorf("HEAD is %s after checkout, expected %s", head, sha)
+	}
+
+	return sha, nil
+}
+
+// resolveCommit returns the full SHA of the commit a revision points to
+func resolveCommit(ctx context.Context, dir, rev string) (string, error) {
+	output, err := runGit(ctx, dir, io.Discard, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// runGit runs a git command in dir, copying its output to out and returning stdout
+func runGit(ctx context.Context, dir string, out io.Writer, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	cmd := newCommand(ctx, dir, "git", args...)
+	cmd.Stdout = io.MultiWriter(&stdout, out)
+	cmd.Stderr = out
+
+	fmt.Fprintf(out, "$ git %s\n", strings.Join(args, " "))
+	err := cmd.Run()
+	return stdout.String(), err
+}
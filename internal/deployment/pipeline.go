@@ -0,0 +1,163 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ktappdev/cicd-thing/internal/config"
+)
+
+// stepsFromConfig converts configured pipeline steps, filling in defaults
+func stepsFromConfig(configured []config.Step) ([]Step, error) {
+	steps := make([]Step, 0, len(configured))
+	for i, s := range configured {
+		if strings.TrimSpace(s.Command) == "" {
+			return nil, fmt.Errorf("step %d has no command", i+1)
+		}
+		if s.Dir != "" && (filepath.IsAbs(s.Dir) || !filepath.IsLocal(s.Dir)) {
+			return nil, fmt.Errorf("step %d: dir %q must be relative to the repository", i+1, s.Dir)
+		}
+
+		name := s.Name
+		if name == "" {
+			name = fmt.Sprintf("step-%d", i+1)
+		}
+
+		steps = append(steps, Step{
+			Name:            name,
+			Command:         s.Command,
+			Dir:             s.Dir,
+			Timeout:         time.Duration(s.TimeoutSeconds) * time.Second,
+			Env:             s.Env,
+			ContinueOnError: s.ContinueOnError,
+			AlwaysRun:       s.AlwaysRun,
+		})
+	}
+	return steps, nil
+}
+
+// stepsFromString turns the "cmd1 && cmd2" shorthand into unnamed steps
+func stepsFromString(commandStr string) []Step {
+	var steps []Step
+	for i, command := range parseCommands(commandStr) {
+		steps = append(steps, Step{
+			Name:    fmt.Sprintf("step-%d", i+1),
+			Command: command,
+		})
+	}
+	return steps
+}
+
+// parseCommands splits a command string on top-level "&&". Separators
+// inside quotes, subshells or command substitutions are left alone.
+func parseCommands(commandStr string) []string {
+	var result []string
+	var current strings.Builder
+	var quote rune
+	depth := 0
+
+	flush := func() {
+		if trimmed := strings.TrimSpace(current.String()); trimmed != "" {
+			result = append(result, trimmed)
+		}
+		current.Reset()
+	}
+
+	runes := []rune(commandStr)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && quote != '\'' && i+1 < len(runes):
+			current.WriteRune(r)
+			i++
+			r = runes[i]
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '(' || r == '{':
+			depth++
+		case (r == ')' || r == '}') && depth > 0:
+			depth--
+		case r == '&' && depth == 0 && i+1 < len(runes) && runes[i+1] == '&':
+			flush()
+			i++
+			continue
+		}
+		current.WriteRune(r)
+	}
+	flush()
+
+	return result
+}
+
+// runStep executes a single pipeline step and reports how it went
+func (e *Executor) runStep(ctx context.Context, req *Request, step Step, writer *outputWriter) StepResult {
+	stepResult := StepResult{
+		Name:      step.Name,
+		Command:   step.Command,
+		StartTime: time.Now(),
+	}
+
+	if step.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, step.Timeout)
+		defer cancel()
+	}
+
+	cmd := newCommand(ctx, filepath.Join(req.LocalPath, step.Dir), "sh", "-c", step.Command)
+	cmd.Env = append(cmd.Env, requestEnv(req)...)
+	for key, value := range step.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	err := cmd.Run()
+	writer.Flush()
+
+	stepResult.Duration = time.Since(stepResult.StartTime)
+	stepResult.ExitCode = exitCode(cmd)
+
+	switch {
+	case err == nil:
+		stepResult.Status = StatusSuccess
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		stepResult.Status = StatusTimeout
+		stepResult.Error = fmt.Sprintf("Step %s timed out", step.Name)
+	case ctx.Err() != nil:
+		stepResult.Status = StatusCancelled
+		stepResult.Error = fmt.Sprintf("Step %s cancelled", step.Name)
+	default:
+		stepResult.Status = StatusFailed
+		stepResult.Error = fmt.Sprintf("Command failed: %s - %v", step.Command, err)
+	}
+
+	return stepResult
+}
+
+// requestEnv describes the request to deploy commands, so a release pipeline
+// can use $DEPLOY_TAG for image tags and a preview $DEPLOY_PR for its port
+func requestEnv(req *Request) []string {
+	pullRequest := ""
+	if req.PullRequest > 0 {
+		pullRequest = strconv.Itoa(req.PullRequest)
+	}
+	return []string{
+		"DEPLOY_ID=" + req.ID,
+		"DEPLOY_REPOSITORY=" + req.Repository,
+		"DEPLOY_APP=" + req.App,
+		"DEPLOY_BRANCH=" + req.Branch,
+		"DEPLOY_ENVIRONMENT=" + req.Environment,
+		"DEPLOY_COMMIT=" + req.Commit,
+		"DEPLOY_TAG=" + req.Tag,
+		"DEPLOY_PR=" + pullRequest,
+	}
+}
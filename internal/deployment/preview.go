@@ -0,0 +1,97 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// previewSteps returns the pipeline for a preview request. ok is false for
+// other requests and when the app's regular pipeline should be used instead.
+func (e *Executor) previewSteps(req *Request, appName string) (steps []Step, ok bool, err error) {
+	if req.PullRequest == 0 {
+		return nil, false, nil
+	}
+	preview := e.configFor(req).Previews[appName]
+
+	if req.Teardown {
+		if len(preview.TeardownSteps) > 0 {
+			steps, err = stepsFromConfig(preview.TeardownSteps)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid preview teardown for app %s: %w", appName, err)
+			}
+			return steps, true, nil
+		}
+		// Without a teardown pipeline the directory is simply removed
+		return stepsFromString(preview.Teardown), true, nil
+	}
+
+	if len(preview.Steps) > 0 {
+		steps, err = stepsFromConfig(preview.Steps)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid preview pipeline for app %s: %w", appName, err)
+		}
+		return steps, true, nil
+	}
+	if preview.Commands != "" {
+		return stepsFromString(preview.Commands), true, nil
+	}
+	return nil, false, nil
+}
+
+// checkoutPreview makes sure the preview directory is a clone of the app's
+// repository and checks out the pull request head. The clone's origin is
+// the production checkout's origin, so existing credentials keep working.
+func (e *Executor) checkoutPreview(ctx context.Context, req *Request, out io.Writer) (string, error) {
+	if _, err := os.Stat(filepath.Join(req.LocalPath, ".git")); os.IsNotExist(err) {
+		productionPath, err := e.mapperFor(req).GetLocalPath(req.Repository)
+		if err != nil {
+			return "", err
+		}
+		originURL, err := runGit(ctx, productionPath, io.Discard, "remote", "get-url", "origin")
+		if err != nil {
+			return "", fmt.Errorf("cannot determine origin of %s: %w", productionPath, err)
+		}
+
+		parent := filepath.Dir(req.LocalPath)
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return "", fmt.Errorf("failed to create %s: %w", parent, err)
+		}
+		if _, err := runGit(ctx, parent, out, "clone", strings.TrimSpace(originURL), req.LocalPath); err != nil {
+			return "", fmt.Errorf("git clone failed: %w", err)
+		}
+	}
+
+	// Fork heads are only reachable through the pull request ref; forges
+	// without one fall back to fetching the head commit directly, which
+	// needs the commit hash - the head branch alone may be stale or a fork's
+	ref := fmt.Sprintf("+refs/pull/%d/head:refs/pull/%d/head", req.PullRequest, req.PullRequest)
+	if _, err := runGit(ctx, req.LocalPath, out, "fetch", "--force", "origin", ref); err != nil {
+		if !shaPattern.MatchString(req.Commit) {
+			return "", fmt.Errorf("git fetch of pull request #%d failed: %w", req.PullRequest, err)
+		}
+		fmt.Fprintf(out, "Pull request ref unavailable (%v), fetching commit %s directly\n", err, req.Commit)
+	}
+
+	// Detach rather than reuse the head branch name, which may belong to a fork
+	detached := *req
+	detached.Branch = ""
+	return checkoutCommit(ctx, &detached, out)
+}
+
+// removePreview deletes a preview directory after its teardown ran
+func (e *Executor) removePreview(req *Request) error {
+	productionPath, err := e.mapperFor(req).GetAppPath(req.Repository, e.appName(req))
+	if err != nil {
+		return err
+	}
+
+	// GetPreviewPath already refuses these, but this is an rm -rf
+	if !filepath.IsAbs(req.LocalPath) || filepath.Clean(req.LocalPath) == filepath.Clean(productionPath) {
+		return fmt.Errorf("refusing to remove %s", req.LocalPath)
+	}
+	return os.RemoveAll(req.LocalPath)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package deployment
+
+import "os/exec"
+
+// setProcessGroup is a no-op on platforms without process groups;
+// cancellation falls back to killing the shell process only
+func setProcessGroup(cmd *exec.Cmd) {}
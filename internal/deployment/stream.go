@@ -0,0 +1,157 @@
+package deployment
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+)
+
+// outputBufferLines is how many lines of output are kept per deployment for
+// late subscribers
+const outputBufferLines = 2000
+
+// OutputBuffer is a bounded ring buffer of output lines that live subscribers
+// can follow. A nil *OutputBuffer discards everything written to it.
+type OutputBuffer struct {
+	mutex       sync.Mutex
+	lines       []string
+	start       int
+	count       int
+	subscribers map[chan string]struct{}
+	closed      bool
+	status      Status
+}
+
+// NewOutputBuffer creates a buffer holding at most capacity lines
+func NewOutputBuffer(capacity int) *OutputBuffer {
+	return &OutputBuffer{
+		lines:       make([]string, capacity),
+		subscribers: make(map[chan string]struct{}),
+	}
+}
+
+// WriteLine appends a line and fans it out to subscribers
+func (b *OutputBuffer) WriteLine(line string) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	// Overwrite the oldest line once the ring is full
+	capacity := len(b.lines)
+	if b.count < capacity {
+		b.lines[(b.start+b.count)%capacity] = line
+		b.count++
+	} else {
+		b.lines[b.start] = line
+		b.start = (b.start + 1) % capacity
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- line:
+		default:
+			// Subscriber is too slow, drop the line rather than block the deployment
+		}
+	}
+}
+
+// Subscribe returns the buffered backlog and a channel of new lines. The
+// channel is closed when the deployment finishes; call unsubscribe to stop early.
+func (b *OutputBuffer) Subscribe() (backlog []string, lines <-chan string, unsubscribe func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	backlog = make([]string, 0, b.count)
+	for i := 0; i < b.count; i++ {
+		backlog = append(backlog, b.lines[(b.start+i)%len(b.lines)])
+	}
+
+	ch := make(chan string, 256)
+	if b.closed {
+		close(ch)
+		return backlog, ch, func() {}
+	}
+
+	b.subscribers[ch] = struct{}{}
+	unsubscribe = func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if _, exists := b.subscribers[ch]; exists {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return backlog, ch, unsubscribe
+}
+
+// Close marks the deployment as finished and closes all subscriber channels
+func (b *OutputBuffer) Close(status Status) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	b.status = status
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Status returns the final status once the buffer is closed
+func (b *OutputBuffer) Status() Status {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.status
+}
+
+// outputWriter tees command output into the full deployment output and,
+// split into lines, into the live output buffer
+type outputWriter struct {
+	mutex   sync.Mutex
+	full    *strings.Builder
+	stream  *OutputBuffer
+	partial []byte
+}
+
+// Write implements io.Writer
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.full.Write(p)
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.stream.WriteLine(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush emits any trailing output that did not end with a newline
+func (w *outputWriter) Flush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(w.partial) > 0 {
+		w.stream.WriteLine(string(w.partial))
+		w.partial = nil
+	}
+}
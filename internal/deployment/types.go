@@ -1,33 +1,102 @@
 package deployment
 
 import (
+	"fmt"
 	"time"
+
+	"github.com/ktappdev/cicd-thing/internal/config"
 )
 
 // Status represents the deployment status
 type Status string
 
 const (
+	StatusQueued    Status = "QUEUED"
 	StatusStarted   Status = "STARTED"
 	StatusSuccess   Status = "SUCCESS"
 	StatusFailed    Status = "FAILED"
 	StatusTimeout   Status = "TIMEOUT"
 	StatusRollback  Status = "ROLLBACK"
 	StatusCancelled Status = "CANCELLED"
+	StatusSkipped   Status = "SKIPPED"
+
+	// StatusSuperseded marks a pending request replaced by a newer one for
+	// the same app before it got to run
+	StatusSuperseded Status = "SUPERSEDED"
+
+	// StatusPendingChecks marks a request held until CI passes on its commit;
+	// StatusChecksFailed one that was dropped because CI failed or never reported
+	StatusPendingChecks Status = "PENDING_CHECKS"
+	StatusChecksFailed  Status = "CHECKS_FAILED"
 )
 
 // Request represents a deployment request
 type Request struct {
-	ID         string
-	Repository string
-	Branch     string
-	Commit     string
-	Message    string
-	Author     string
-	Timestamp  time.Time
-	LocalPath  string
-	Commands   []string
-	Manual     bool // true if triggered manually via API
+	ID             string
+	Repository     string
+	App            string // id of the app being deployed; defaults to the repository's app
+	Branch         string
+	Environment    string // named environment the branch maps to, if any
+	Commit         string
+	Message        string
+	Author         string
+	Timestamp      time.Time
+	LocalPath      string
+	Steps          []Step
+	Metadata       map[string]string // free-form details supplied by the trigger
+	Directives     []string          // commit message directives that applied, e.g. "[no-rollback]"
+	NoRollback     bool              // skip auto-rollback for this run
+	Manual         bool              // true if triggered manually via API
+	Tag            string            // set for tag and release deployments
+	PullRequest    int               // set for pull request preview deployments
+	Teardown       bool              // remove the preview instead of deploying it
+	QueuedAt       time.Time         // when the request entered the queue
+	HeldForChecks  bool              // waited for CI before being queued
+	ChecksPassedAt time.Time         // when CI released it
+
+	config *config.Config // configuration the request was accepted under
+}
+
+// IsRelease reports whether the request deploys a tag or release
+func (r *Request) IsRelease() bool {
+	return r.Tag != ""
+}
+
+// Target describes what is being deployed, e.g. "main", "develop → staging",
+// "release v1.2.0" or "PR #42"
+func (r *Request) Target() string {
+	if r.PullRequest > 0 {
+		return fmt.Sprintf("PR #%d", r.PullRequest)
+	}
+	if r.IsRelease() {
+		return "release " + r.Tag
+	}
+	if r.Environment != "" {
+		return r.Branch + " → " + r.Environment
+	}
+	return r.Branch
+}
+
+// Step is a single command in a deployment pipeline
+type Step struct {
+	Name            string
+	Command         string
+	Dir             string        // relative to the repository
+	Timeout         time.Duration // 0 means only the deployment timeout applies
+	Env             map[string]string
+	ContinueOnError bool
+	AlwaysRun       bool
+}
+
+// StepResult records how a single pipeline step went
+type StepResult struct {
+	Name      string        `json:"name"`
+	Command   string        `json:"command"`
+	Status    Status        `json:"status"`
+	StartTime time.Time     `json:"start_time,omitzero"`
+	Duration  time.Duration `json:"duration"`
+	ExitCode  int           `json:"exit_code"`
+	Error     string        `json:"error,omitempty"`
 }
 
 // Result represents the result of a deployment
@@ -40,19 +109,65 @@ type Result struct {
 	Output    string
 	Error     string
 	ExitCode  int
+	Events    []Event      // status transitions in the order they happened
+	Steps     []StepResult // per-step outcome in pipeline order
+
+	// ResolvedCommit is the full SHA that was checked out and deployed
+	ResolvedCommit string
+
+	// SupersededBy is the ID of the request that replaced this one
+	SupersededBy string
+
+	// RollbackError is why the rollback command failed, if one ran and did
+	RollbackError string
 }
 
 // Event represents a deployment event for logging
 type Event struct {
-	ID         string
-	Repository string
-	Branch     string
-	Commit     string
-	Status     Status
-	Timestamp  time.Time
-	Message    string
-	Error      string
-	Duration   time.Duration
+	ID          string
+	Repository  string
+	Branch      string
+	Environment string
+	Commit      string
+	Status      Status
+	Timestamp   time.Time
+	Message     string
+	Error       string
+	Duration    time.Duration
+	Step        string // pipeline step name, empty for whole-deployment events
+	Author      string // who triggered the event, e.g. the name of an API key
+}
+
+// recordEvent appends a status transition to the result
+func (r *Result) recordEvent(status Status, message string) {
+	r.Events = append(r.Events, Event{
+		ID:          r.Request.ID,
+		Repository:  r.Request.Repository,
+		Branch:      r.Request.Branch,
+		Environment: r.Request.Environment,
+		Commit:      r.Request.Commit,
+		Status:      status,
+		Timestamp:   time.Now(),
+		Message:     message,
+	})
+}
+
+// Deployment is a snapshot of a queued or running deployment
+type Deployment struct {
+	ID          string    `json:"id"`
+	Repository  string    `json:"repository"`
+	App         string    `json:"app,omitempty"`
+	Branch      string    `json:"branch"`
+	Environment string    `json:"environment,omitempty"`
+	Tag         string    `json:"tag,omitempty"`
+	PullRequest int       `json:"pull_request,omitempty"`
+	Teardown    bool      `json:"teardown,omitempty"`
+	Commit      string    `json:"commit"`
+	Author      string    `json:"author"`
+	Manual      bool      `json:"manual"`
+	Status      Status    `json:"status"`
+	QueuedAt    time.Time `json:"queued_at"`
+	StartTime   time.Time `json:"start_time,omitzero"`
 }
 
 // Lock represents a deployment lock for an application
@@ -0,0 +1,310 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ktappdev/cicd-thing/internal/deployment"
+	"github.com/ktappdev/cicd-thing/internal/logger"
+)
+
+// maxRecordSize is the longest history line loaded; records keep only the
+// tail of their output, so only a damaged file has longer ones
+const maxRecordSize = 16 * 1024 * 1024
+
+// minCompaction is the number of stale lines the history file may collect
+// before it is rewritten, however few records it holds
+const minCompaction = 100
+
+// errLineTooLong is returned by readLine for lines over its limit
+var errLineTooLong = errors.New("line too long")
+
+// FileStore is an embedded history store backed by a JSON lines file.
+// All records are kept in memory and appended to the file as they arrive.
+// Lines of records dropped by retention or replaced by a newer record with
+// the same ID stay in the file until there are as many of them as live
+// records, then the file is rewritten, so compaction costs each deployment
+// a constant amount of I/O on average.
+type FileStore struct {
+	path       string
+	retention  time.Duration
+	maxEntries int
+	maxOutput  int
+	mutex      sync.RWMutex
+	file       *os.File
+	records    []*Record
+	index      map[string]*Record
+	stale      int // lines in the file that no longer back a record
+	logger     *logger.Logger
+}
+
+// NewFileStore opens (or creates) the history file at path and loads its
+// records. Records keep the last maxOutput bytes of their output; 0 keeps
+// all of it.
+func NewFileStore(path string, retention time.Duration, maxEntries, maxOutput int, logger *logger.Logger) (*FileStore, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create history directory %s: %w", dir, err)
+		}
+	}
+
+	s := &FileStore{
+		path:       path,
+		retention:  retention,
+		maxEntries: maxEntries,
+		maxOutput:  maxOutput,
+		index:      make(map[string]*Record),
+		logger:     logger,
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	// Apply retention to whatever was on disk and compact the file
+	s.prune()
+	if err := s.rewrite(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Record saves the outcome of a deployment
+func (s *FileStore) Record(result *deployment.Result) error {
+	record := NewRecord(result)
+	record.Output = tailOutput(record.Output, s.maxOutput)
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history record: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.add(record) {
+		s.stale++
+	}
+	s.stale += s.prune()
+
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write history record: %w", err)
+	}
+	if s.stale >= max(len(s.records), minCompaction) {
+		return s.rewrite()
+	}
+	return nil
+}
+
+// Get returns the record with the given deployment ID
+func (s *FileStore) Get(id string) (*Record, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	record, exists := s.index[id]
+	return record, exists
+}
+
+// Query returns records matching the filter, newest first
+func (s *FileStore) Query(filter Filter) []*Record {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var matches []*Record
+	for i := len(s.records) - 1; i >= 0; i-- {
+		if !filter.Matches(s.records[i]) {
+			continue
+		}
+		matches = append(matches, s.records[i])
+		if filter.Limit > 0 && len(matches) >= filter.Limit {
+			break
+		}
+	}
+	return matches
+}
+
+// Close closes the underlying history file
+func (s *FileStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file != nil {
+		return s.file.Close()
+	}
+	return nil
+}
+
+// load reads existing records from the history file
+func (s *FileStore) load() error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open history file %s: %w", s.path, err)
+	}
+	defer file.Close()
+
+	// A bad line costs one record, never the whole history
+	reader := bufio.NewReader(file)
+	for number := 1; ; number++ {
+		line, err := readLine(reader, maxRecordSize)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, errLineTooLong) {
+			s.logf("Skipping line %d of history file %s: longer than %d bytes", number, s.path, maxRecordSize)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read history file %s: %w", s.path, err)
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			// e.g. a partial write before a crash
+			s.logf("Skipping line %d of history file %s: %v", number, s.path, err)
+			continue
+		}
+		// Records written under a higher history_max_output_bytes
+		record.Output = tailOutput(record.Output, s.maxOutput)
+		s.add(&record)
+	}
+
+	// Keep records ordered by completion time
+	sort.SliceStable(s.records, func(i, j int) bool {
+		return s.records[i].EndTime.Before(s.records[j].EndTime)
+	})
+	return nil
+}
+
+// readLine reads the next line without its line break. A line longer than
+// limit is consumed and reported as errLineTooLong rather than held in
+// memory; io.EOF means there are no more lines.
+func readLine(reader *bufio.Reader, limit int) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLong && len(line)+len(chunk) > limit+1 {
+			tooLong, line = true, nil
+		} else if !tooLong {
+			line = append(line, chunk...)
+		}
+
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && (len(line) > 0 || tooLong):
+			// The last line has no line break
+		case err != nil:
+			return nil, err
+		}
+		if tooLong {
+			return nil, errLineTooLong
+		}
+		return bytes.TrimRight(line, "\r\n"), nil
+	}
+}
+
+// logf logs an informational message if the store has a logger
+func (s *FileStore) logf(format string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.LogInfo(fmt.Sprintf(format, args...))
+	}
+}
+
+// add inserts or replaces a record, reporting whether it replaced one
+// (caller must hold the lock)
+func (s *FileStore) add(record *Record) bool {
+	existing, exists := s.index[record.ID]
+	if exists {
+		for i, r := range s.records {
+			if r == existing {
+				s.records = append(s.records[:i], s.records[i+1:]...)
+				break
+			}
+		}
+	}
+	s.records = append(s.records, record)
+	s.index[record.ID] = record
+	return exists
+}
+
+// prune drops records outside the retention window and returns how many
+// it dropped (caller must hold the lock)
+func (s *FileStore) prune() int {
+	start := 0
+	if s.retention > 0 {
+		cutoff := time.Now().Add(-s.retention)
+		for start < len(s.records) && s.records[start].EndTime.Before(cutoff) {
+			start++
+		}
+	}
+	if s.maxEntries > 0 && len(s.records)-start > s.maxEntries {
+		start = len(s.records) - s.maxEntries
+	}
+	if start == 0 {
+		return 0
+	}
+
+	for _, record := range s.records[:start] {
+		delete(s.index, record.ID)
+	}
+	s.records = append([]*Record(nil), s.records[start:]...)
+	return start
+}
+
+// rewrite replaces the history file with the current records (caller must hold the lock)
+func (s *FileStore) rewrite() error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create history file %s: %w", tmpPath, err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	for _, record := range s.records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to marshal history record: %w", err)
+		}
+		writer.Write(data)
+		writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write history file %s: %w", tmpPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write history file %s: %w", tmpPath, err)
+	}
+
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to replace history file %s: %w", s.path, err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file %s: %w", s.path, err)
+	}
+	s.file = file
+	s.stale = 0
+	return nil
+}
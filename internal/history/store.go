@@ -0,0 +1,178 @@
+package history
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ktappdev/cicd-thing/internal/deployment"
+)
+
+// Store persists deployment records so they survive restarts
+type Store interface {
+	// Record saves the outcome of a deployment
+	Record(result *deployment.Result) error
+	// Get returns the record with the given deployment ID
+	Get(id string) (*Record, bool)
+	// Query returns records matching the filter, newest first
+	Query(filter Filter) []*Record
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// Record is a persisted Request/Result pair
+type Record struct {
+	ID          string                  `json:"id"`
+	Repository  string                  `json:"repository"`
+	App         string                  `json:"app,omitempty"`
+	Branch      string                  `json:"branch"`
+	Environment string                  `json:"environment,omitempty"`
+	Tag         string                  `json:"tag,omitempty"`
+	Release     bool                    `json:"release,omitempty"`
+	PullRequest int                     `json:"pull_request,omitempty"`
+	Teardown    bool                    `json:"teardown,omitempty"`
+	Commit      string                  `json:"commit"`
+	Resolved    string                  `json:"resolved_commit,omitempty"`
+	Message     string                  `json:"message,omitempty"`
+	Author      string                  `json:"author,omitempty"`
+	Manual      bool                    `json:"manual"`
+	LocalPath   string                  `json:"local_path,omitempty"`
+	Metadata    map[string]string       `json:"metadata,omitempty"`
+	Directives  []string                `json:"directives,omitempty"`
+	Steps       []deployment.StepResult `json:"steps,omitempty"`
+	Status      deployment.Status       `json:"status"`
+	QueuedAt    time.Time               `json:"queued_at,omitzero"`
+	StartTime   time.Time               `json:"start_time"`
+	EndTime     time.Time               `json:"end_time"`
+	Duration    time.Duration           `json:"duration"`
+	Output      string                  `json:"output,omitempty"`
+	Error       string                  `json:"error,omitempty"`
+	ExitCode    int                     `json:"exit_code"`
+	Superseded  string                  `json:"superseded_by,omitempty"`
+	Transitions []Transition            `json:"transitions,omitempty"`
+}
+
+// Transition records a single status change of a deployment
+type Transition struct {
+	Status    deployment.Status `json:"status"`
+	Timestamp time.Time         `json:"timestamp"`
+	Message   string            `json:"message,omitempty"`
+}
+
+// Filter narrows down a history query; zero values match everything
+type Filter struct {
+	Repository  string
+	App         string
+	Branch      string
+	Environment string
+	Status      deployment.Status
+	Since       time.Time
+	Until       time.Time
+	Limit       int
+}
+
+// NewRecord builds a history record from a deployment result
+func NewRecord(result *deployment.Result) *Record {
+	req := result.Request
+	record := &Record{
+		ID:          req.ID,
+		Repository:  req.Repository,
+		App:         req.App,
+		Branch:      req.Branch,
+		Environment: req.Environment,
+		Tag:         req.Tag,
+		Release:     req.IsRelease(),
+		PullRequest: req.PullRequest,
+		Teardown:    req.Teardown,
+		Commit:      req.Commit,
+		Resolved:    result.ResolvedCommit,
+		Message:     req.Message,
+		Author:      req.Author,
+		Manual:      req.Manual,
+		LocalPath:   req.LocalPath,
+		Metadata:    req.Metadata,
+		Directives:  req.Directives,
+		Steps:       result.Steps,
+		Status:      result.Status,
+		QueuedAt:    req.QueuedAt,
+		StartTime:   result.StartTime,
+		EndTime:     result.EndTime,
+		Duration:    result.Duration,
+		Output:      result.Output,
+		Error:       result.Error,
+		ExitCode:    result.ExitCode,
+		Superseded:  result.SupersededBy,
+	}
+
+	if req.HeldForChecks {
+		record.Transitions = append(record.Transitions, Transition{
+			Status:    deployment.StatusPendingChecks,
+			Timestamp: req.QueuedAt,
+		})
+		if !req.ChecksPassedAt.IsZero() {
+			record.Transitions = append(record.Transitions, Transition{
+				Status:    deployment.StatusQueued,
+				Timestamp: req.ChecksPassedAt,
+				Message:   "Checks passed",
+			})
+		}
+	} else if !req.QueuedAt.IsZero() {
+		record.Transitions = append(record.Transitions, Transition{
+			Status:    deployment.StatusQueued,
+			Timestamp: req.QueuedAt,
+		})
+	}
+	for _, event := range result.Events {
+		record.Transitions = append(record.Transitions, Transition{
+			Status:    event.Status,
+			Timestamp: event.Timestamp,
+			Message:   event.Message,
+		})
+	}
+
+	return record
+}
+
+// Matches reports whether the record satisfies the filter
+func (f Filter) Matches(r *Record) bool {
+	if f.Repository != "" && r.Repository != f.Repository {
+		return false
+	}
+	if f.App != "" && r.App != f.App {
+		return false
+	}
+	if f.Branch != "" && r.Branch != f.Branch {
+		return false
+	}
+	if f.Environment != "" && r.Environment != f.Environment {
+		return false
+	}
+	if f.Status != "" && r.Status != f.Status {
+		return false
+	}
+	if !f.Since.IsZero() && r.EndTime.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && r.EndTime.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// tailOutput returns the last limit bytes of output, starting at a line
+// where one begins, and marks where earlier output was dropped. A limit of
+// 0 keeps all of it.
+func tailOutput(output string, limit int) string {
+	if limit <= 0 || len(output) <= limit {
+		return output
+	}
+
+	start := len(output) - limit
+	if i := strings.IndexByte(output[start:len(output)-1], '\n'); i >= 0 {
+		start += i + 1
+	}
+	for start < len(output) && !utf8.RuneStart(output[start]) {
+		start++
+	}
+	return "[earlier output truncated]\n" + output[start:]
+}
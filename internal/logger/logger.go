@@ -62,13 +62,14 @@ func (l *Logger) LogDeploymentEvent(event *deployment.Event) {
 // LogDeploymentResult logs a deployment result
 func (l *Logger) LogDeploymentResult(result *deployment.Result) {
 	event := &deployment.Event{
-		ID:         result.Request.ID,
-		Repository: result.Request.Repository,
-		Branch:     result.Request.Branch,
-		Commit:     result.Request.Commit,
-		Status:     result.Status,
-		Timestamp:  result.EndTime,
-		Duration:   result.Duration,
+		ID:          result.Request.ID,
+		Repository:  result.Request.Repository,
+		Branch:      result.Request.Target(),
+		Environment: result.Request.Environment,
+		Commit:      result.Request.Commit,
+		Status:      result.Status,
+		Timestamp:   result.EndTime,
+		Duration:    result.Duration,
 	}
 
 	if result.Error != "" {
@@ -79,6 +80,22 @@ func (l *Logger) LogDeploymentResult(result *deployment.Result) {
 	}
 
 	l.LogDeploymentEvent(event)
+
+	// One line per pipeline step so slow or failing steps stand out
+	for _, step := range result.Steps {
+		l.LogDeploymentEvent(&deployment.Event{
+			ID:          result.Request.ID,
+			Repository:  result.Request.Repository,
+			Branch:      result.Request.Target(),
+			Environment: result.Request.Environment,
+			Commit:      result.Request.Commit,
+			Status:      step.Status,
+			Timestamp:   result.EndTime,
+			Duration:    step.Duration,
+			Error:       step.Error,
+			Step:        step.Name,
+		})
+	}
 }
 
 // LogWebhookReceived logs when a webhook is received
@@ -94,8 +111,9 @@ func (l *Logger) LogWebhookReceived(repository, branch, commit, author string) {
 	l.LogDeploymentEvent(event)
 }
 
-// LogManualTrigger logs when a manual deployment is triggered
-func (l *Logger) LogManualTrigger(repository, branch, commit string) {
+// LogManualTrigger logs when a manual deployment is triggered, and by which
+// API key
+func (l *Logger) LogManualTrigger(repository, branch, commit, keyName string) {
 	event := &deployment.Event{
 		Repository: repository,
 		Branch:     branch,
@@ -103,6 +121,7 @@ func (l *Logger) LogManualTrigger(repository, branch, commit string) {
 		Status:     "MANUAL_TRIGGER",
 		Timestamp:  time.Now(),
 		Message:    "Manual deployment triggered via API",
+		Author:     keyName,
 	}
 	l.LogDeploymentEvent(event)
 }
@@ -154,7 +173,7 @@ func (l *Logger) logEventDirect(event *deployment.Event) {
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
 
-	// Format: timestamp | repository | branch | commit | status | duration | message
+	// Format: timestamp | repository | branch | commit | status | duration | step | author | error
 	timestamp := event.Timestamp.Format(time.RFC3339)
 	
 	var durationStr string
@@ -162,18 +181,30 @@ func (l *Logger) logEventDirect(event *deployment.Event) {
 		durationStr = fmt.Sprintf(" | %v", event.Duration.Round(time.Millisecond))
 	}
 
+	var stepStr string
+	if event.Step != "" {
+		stepStr = fmt.Sprintf(" | step: %s", event.Step)
+	}
+
+	var authorStr string
+	if event.Author != "" {
+		authorStr = fmt.Sprintf(" | by: %s", event.Author)
+	}
+
 	var errorStr string
 	if event.Error != "" {
 		errorStr = fmt.Sprintf(" | error: %s", event.Error)
 	}
 
-	logLine := fmt.Sprintf("%s | %s | %s | %s | %s%s%s",
+	logLine := fmt.Sprintf("%s | %s | %s | %s | %s%s%s%s%s",
 		timestamp,
 		event.Repository,
 		event.Branch,
 		event.Commit,
 		event.Status,
 		durationStr,
+		stepStr,
+		authorStr,
 		errorStr,
 	)
 
@@ -1,30 +1,41 @@
 package mapping
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/user"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/ktappdev/cicd-thing/internal/config"
 )
 
 // Mapper handles repository to local path mapping
 type Mapper struct {
-	config *config.Config
+	config atomic.Pointer[config.Config]
 }
 
 // New creates a new mapper instance
 func New(cfg *config.Config) *Mapper {
-	return &Mapper{
-		config: cfg,
-	}
+	m := &Mapper{}
+	m.config.Store(cfg)
+	return m
+}
+
+// Reload switches the mapper to a new configuration
+func (m *Mapper) Reload(cfg *config.Config) {
+	m.config.Store(cfg)
 }
 
 // GetLocalPath returns the local path for a given repository
 func (m *Mapper) GetLocalPath(repoFullName string) (string, error) {
-	localPath, exists := m.config.RepoMap[repoFullName]
+	localPath, exists := m.config.Load().RepoMap[repoFullName]
 	if !exists {
 		return "", fmt.Errorf("no mapping found for repository %s", repoFullName)
 	}
@@ -38,14 +49,153 @@ func (m *Mapper) GetLocalPath(repoFullName string) (string, error) {
 	return expandedPath, nil
 }
 
-// GetAppName extracts the application name from repository full name
-// For example: "octocat/Hello-World" -> "Hello-World"
+// ErrNoEnvironment is returned when an app has environments but none of
+// them matches the branch
+var ErrNoEnvironment = errors.New("no environment matches the branch")
+
+// GetApps returns the apps deployed from a repository: the apps of its
+// monorepo entry if it has one, otherwise just its short name
+func (m *Mapper) GetApps(repoFullName string) []string {
+	monorepo := m.config.Load().Monorepos[repoFullName]
+	if len(monorepo) == 0 {
+		return []string{m.GetAppName(repoFullName)}
+	}
+
+	apps := make([]string, 0, len(monorepo))
+	for _, app := range monorepo {
+		apps = append(apps, app.App)
+	}
+	return apps
+}
+
+// GetMonorepoApp returns the monorepo entry of appName in a repository
+func (m *Mapper) GetMonorepoApp(repoFullName, appName string) (*config.MonorepoApp, bool) {
+	monorepo := m.config.Load().Monorepos[repoFullName]
+	for i := range monorepo {
+		if monorepo[i].App == appName {
+			return &monorepo[i], true
+		}
+	}
+	return nil, false
+}
+
+// GetAppPath returns the local path of an app, which is the repository
+// mapping unless the app's monorepo entry has a path of its own
+func (m *Mapper) GetAppPath(repoFullName, appName string) (string, error) {
+	app, exists := m.GetMonorepoApp(repoFullName, appName)
+	if !exists || app.Path == "" {
+		return m.GetLocalPath(repoFullName)
+	}
+
+	expandedPath, err := m.expandPath(app.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to expand path %s: %w", app.Path, err)
+	}
+	return expandedPath, nil
+}
+
+// ResolveEnvironment returns the first environment of the app whose branch
+// patterns match branch. It returns nil without error if the app has no
+// environments configured.
+func (m *Mapper) ResolveEnvironment(appName, branch string) (*config.Environment, error) {
+	environments := m.config.Load().Environments[appName]
+	if len(environments) == 0 {
+		return nil, nil
+	}
+
+	for i := range environments {
+		for _, pattern := range environments[i].Branches {
+			if matched, _ := path.Match(pattern, branch); matched {
+				return &environments[i], nil
+			}
+		}
+	}
+	return nil, ErrNoEnvironment
+}
+
+// GetEnvironment returns the named environment of an app
+func (m *Mapper) GetEnvironment(appName, name string) (*config.Environment, bool) {
+	environments := m.config.Load().Environments[appName]
+	for i := range environments {
+		if environments[i].Name == name {
+			return &environments[i], true
+		}
+	}
+	return nil, false
+}
+
+// GetEnvironmentPath returns the local path of an environment, falling back
+// to the app's path when env is nil or has no path of its own
+func (m *Mapper) GetEnvironmentPath(repoFullName, appName string, env *config.Environment) (string, error) {
+	if env == nil || env.Path == "" {
+		return m.GetAppPath(repoFullName, appName)
+	}
+
+	expandedPath, err := m.expandPath(env.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to expand path %s: %w", env.Path, err)
+	}
+	return expandedPath, nil
+}
+
+// GetPreviewPath returns the directory a pull request of the app is
+// deployed to, rendered from the app's preview path template
+func (m *Mapper) GetPreviewPath(repoFullName, appName string, pr int) (string, error) {
+	localPath, err := m.GetAppPath(repoFullName, appName)
+	if err != nil {
+		return "", err
+	}
+
+	template := m.config.Load().Previews[appName].Path
+	if template == "" {
+		template = "{path}-pr-{pr}"
+	}
+
+	replacer := strings.NewReplacer(
+		"{path}", localPath,
+		"{app}", appName,
+		"{pr}", strconv.Itoa(pr),
+	)
+	previewPath, err := m.expandPath(replacer.Replace(template))
+	if err != nil {
+		return "", fmt.Errorf("failed to expand preview path %s: %w", template, err)
+	}
+
+	// The preview directory is deleted on teardown, so it must never be
+	// the production checkout or one of its parents
+	if previewPath == localPath || !strings.Contains(template, "{pr}") {
+		return "", fmt.Errorf("preview path %s for %s must be unique per pull request", template, appName)
+	}
+	if rel, err := filepath.Rel(previewPath, localPath); err == nil && filepath.IsLocal(rel) {
+		return "", fmt.Errorf("preview path %s contains the production path %s", previewPath, localPath)
+	}
+
+	return previewPath, nil
+}
+
+// GetAppName returns the identifier of the app deployed from a repository,
+// declared under [apps] or, for older configs, the repository's short name
+// ("octocat/Hello-World" -> "Hello-World")
 func (m *Mapper) GetAppName(repoFullName string) string {
-	parts := strings.Split(repoFullName, "/")
-	if len(parts) >= 2 {
-		return parts[1]
+	return m.config.Load().AppID(repoFullName)
+}
+
+// GetRepository returns the mapped repository that deploys appName. App
+// ids are unique across repositories, so at most one does.
+func (m *Mapper) GetRepository(appName string) (string, bool) {
+	repoMap := m.config.Load().RepoMap
+	repos := make([]string, 0, len(repoMap))
+	for repo := range repoMap {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+
+	for _, repo := range repos {
+		if slices.Contains(m.GetApps(repo), appName) {
+			return repo, true
+		}
 	}
-	return repoFullName
+	return "", false
 }
 
 // expandPath expands ~ and environment variables in paths
@@ -98,7 +248,7 @@ func (m *Mapper) ValidatePath(path string) error {
 // ListMappings returns all configured repository mappings
 func (m *Mapper) ListMappings() map[string]string {
 	result := make(map[string]string)
-	for repo, path := range m.config.RepoMap {
+	for repo, path := range m.config.Load().RepoMap {
 		expandedPath, err := m.expandPath(path)
 		if err != nil {
 			// If expansion fails, use original path
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/ktappdev/cicd-thing/internal/config"
@@ -13,14 +14,19 @@ import (
 
 // Notifier handles sending notifications
 type Notifier struct {
-	config *config.Config
+	config atomic.Pointer[config.Config]
 }
 
 // New creates a new notifier instance
 func New(cfg *config.Config) *Notifier {
-	return &Notifier{
-		config: cfg,
-	}
+	n := &Notifier{}
+	n.config.Store(cfg)
+	return n
+}
+
+// Reload switches the notifier to a new configuration
+func (n *Notifier) Reload(cfg *config.Config) {
+	n.config.Store(cfg)
 }
 
 // NotifyDeploymentResult sends notifications based on deployment results
@@ -32,9 +38,11 @@ func (n *Notifier) NotifyDeploymentResult(result *deployment.Result) {
 	case deployment.StatusFailed:
 		shouldNotify = true
 	case deployment.StatusRollback:
-		shouldNotify = n.config.NotifyOnRollback
+		shouldNotify = n.config.Load().NotifyOnRollback
 	case deployment.StatusTimeout:
 		shouldNotify = true
+	case deployment.StatusChecksFailed:
+		shouldNotify = true
 	case deployment.StatusSuccess:
 		// Could add config option for success notifications
 		shouldNotify = false
@@ -64,19 +72,22 @@ func (n *Notifier) formatNotificationMessage(result *deployment.Result) string {
 	switch result.Status {
 	case deployment.StatusFailed:
 		return fmt.Sprintf("🚨 Deployment FAILED for %s (%s): %s", 
-			result.Request.Repository, result.Request.Branch, result.Error)
+			result.Request.App, result.Request.Target(), result.Error)
 	case deployment.StatusRollback:
 		return fmt.Sprintf("🔄 Deployment ROLLED BACK for %s (%s): %s", 
-			result.Request.Repository, result.Request.Branch, result.Error)
+			result.Request.App, result.Request.Target(), result.Error)
 	case deployment.StatusTimeout:
 		return fmt.Sprintf("⏰ Deployment TIMED OUT for %s (%s) after %v", 
-			result.Request.Repository, result.Request.Branch, result.Duration)
+			result.Request.App, result.Request.Target(), result.Duration)
 	case deployment.StatusSuccess:
 		return fmt.Sprintf("✅ Deployment SUCCESS for %s (%s) in %v", 
-			result.Request.Repository, result.Request.Branch, result.Duration)
+			result.Request.App, result.Request.Target(), result.Duration)
+	case deployment.StatusChecksFailed:
+		return fmt.Sprintf("🛑 Deployment BLOCKED by CI for %s (%s): %s",
+			result.Request.App, result.Request.Target(), result.Error)
 	default:
 		return fmt.Sprintf("📋 Deployment %s for %s (%s)", 
-			result.Status, result.Request.Repository, result.Request.Branch)
+			result.Status, result.Request.App, result.Request.Target())
 	}
 }
 
@@ -115,12 +126,17 @@ func (n *Notifier) sendSlackNotification(result *deployment.Result) error {
 
 	color := "good"
 	switch result.Status {
-	case deployment.StatusFailed, deployment.StatusTimeout:
+	case deployment.StatusFailed, deployment.StatusTimeout, deployment.StatusChecksFailed:
 		color = "danger"
 	case deployment.StatusRollback:
 		color = "warning"
 	}
 
+	refField := Field{Title: "Branch", Value: result.Request.Branch, Short: true}
+	if result.Request.IsRelease() {
+		refField = Field{Title: "Release", Value: result.Request.Tag, Short: true}
+	}
+
 	payload := SlackWebhookPayload{
 		Username:  "CI/CD Thing",
 		IconEmoji: ":robot_face:",
@@ -131,14 +147,19 @@ func (n *Notifier) sendSlackNotification(result *deployment.Result) error {
 				Text:      n.formatNotificationMessage(result),
 				Timestamp: result.EndTime.Unix(),
 				Fields: []Field{
+					{Title: "App", Value: result.Request.App, Short: true},
 					{Title: "Repository", Value: result.Request.Repository, Short: true},
-					{Title: "Branch", Value: result.Request.Branch, Short: true},
-					{Title: "Commit", Value: result.Request.Commit[:8], Short: true},
+					refField,
+					{Title: "Commit", Value: shortCommit(result), Short: true},
 					{Title: "Duration", Value: result.Duration.String(), Short: true},
 				},
 			},
 		},
 	}
+	if result.Request.Environment != "" {
+		payload.Attachments[0].Fields = append(payload.Attachments[0].Fields,
+			Field{Title: "Environment", Value: result.Request.Environment, Short: true})
+	}
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
@@ -172,7 +193,7 @@ func (n *Notifier) sendEmailNotification(result *deployment.Result) error {
 	
 	email := EmailNotification{
 		To:      "", // n.config.NotificationEmail
-		Subject: fmt.Sprintf("Deployment %s: %s", result.Status, result.Request.Repository),
+		Subject: fmt.Sprintf("Deployment %s: %s", result.Status, result.Request.App),
 		Body:    n.formatEmailBody(result),
 	}
 
@@ -186,6 +207,7 @@ func (n *Notifier) formatEmailBody(result *deployment.Result) string {
 	body := fmt.Sprintf(`
 Deployment Notification
 
+App: %s
 Repository: %s
 Branch: %s
 Commit: %s
@@ -193,9 +215,16 @@ Status: %s
 Duration: %s
 Timestamp: %s
 
-`, result.Request.Repository, result.Request.Branch, result.Request.Commit,
+`, result.Request.App, result.Request.Repository, result.Request.Branch, result.Request.Commit,
 		result.Status, result.Duration, result.EndTime.Format(time.RFC3339))
 
+	if result.Request.Environment != "" {
+		body += fmt.Sprintf("Environment: %s\n\n", result.Request.Environment)
+	}
+	if result.Request.IsRelease() {
+		body += fmt.Sprintf("Release: %s\n\n", result.Request.Tag)
+	}
+
 	if result.Error != "" {
 		body += fmt.Sprintf("Error: %s\n\n", result.Error)
 	}
@@ -216,15 +245,20 @@ func (n *Notifier) sendWebhookNotification(result *deployment.Result) error {
 	}
 
 	payload := map[string]interface{}{
-		"event":      "deployment",
-		"status":     result.Status,
-		"repository": result.Request.Repository,
-		"branch":     result.Request.Branch,
-		"commit":     result.Request.Commit,
-		"duration":   result.Duration.Seconds(),
-		"timestamp":  result.EndTime.Unix(),
-		"error":      result.Error,
-		"manual":     result.Request.Manual,
+		"event":        "deployment",
+		"status":       result.Status,
+		"repository":   result.Request.Repository,
+		"app":          result.Request.App,
+		"branch":       result.Request.Branch,
+		"environment":  result.Request.Environment,
+		"commit":       result.Request.Commit,
+		"duration":     result.Duration.Seconds(),
+		"timestamp":    result.EndTime.Unix(),
+		"error":        result.Error,
+		"manual":       result.Request.Manual,
+		"tag":          result.Request.Tag,
+		"release":      result.Request.IsRelease(),
+		"pull_request": result.Request.PullRequest,
 	}
 
 	jsonData, err := json.Marshal(payload)
@@ -244,3 +278,16 @@ func (n *Notifier) sendWebhookNotification(result *deployment.Result) error {
 
 	return nil
 }
+
+// shortCommit abbreviates the deployed commit, preferring the SHA resolved at
+// checkout since tag and release requests name a tag rather than a commit
+func shortCommit(result *deployment.Result) string {
+	commit := result.Request.Commit
+	if result.ResolvedCommit != "" {
+		commit = result.ResolvedCommit
+	}
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
@@ -0,0 +1,110 @@
+package security
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ktappdev/cicd-thing/internal/audit"
+)
+
+// Refusals of requests nobody could be identified for are audited at most
+// once per source IP every anonymousDenialInterval, for up to
+// maxDenialSources addresses at a time; the ones in between are counted
+// into the next entry. A flood of bad requests thus can't grow the log
+// without limit.
+const (
+	anonymousDenialInterval = 10 * time.Minute
+	maxDenialSources        = 1024
+)
+
+// denialCount tracks the unaudited refusals of one source IP
+type denialCount struct {
+	since      time.Time // when the last entry for it was written
+	suppressed int
+}
+
+// Audit records an action in the audit log, with the client IP of the
+// request it was made in and, unless the entry names one, its identity
+func (m *Middleware) Audit(r *http.Request, entry audit.Entry) {
+	if entry.Identity == "" {
+		identity := IdentityFrom(r)
+		entry.Identity, entry.Credential = identity.Name, identity.Credential
+	}
+	entry.SourceIP, _ = m.clientIP(r)
+	m.record(entry)
+}
+
+// deny refuses a request and records the refusal in the audit log. The
+// identity is empty if the request couldn't be authenticated, in which case
+// refusals from the same address are coalesced.
+func (m *Middleware) deny(w http.ResponseWriter, r *http.Request, identity Identity, status int, message string) {
+	http.Error(w, message, status)
+
+	entry := audit.Entry{
+		Identity:   identity.Name,
+		Credential: identity.Credential,
+		Action:     audit.ActionAccess,
+		Outcome:    audit.OutcomeDenied,
+		Detail:     fmt.Sprintf("%s %s: %s", r.Method, r.URL.Path, message),
+	}
+	entry.SourceIP, _ = m.clientIP(r)
+	if identity.Name == "" {
+		audited, suppressed := m.coalesceDenial(entry.SourceIP)
+		if !audited {
+			return
+		}
+		if suppressed > 0 {
+			entry.Detail += fmt.Sprintf(" (%d more refusals from this address since the last entry)", suppressed)
+		}
+	}
+	m.record(entry)
+}
+
+// coalesceDenial reports whether an anonymous refusal from ip is to be
+// audited, and how many were counted instead since its last entry
+func (m *Middleware) coalesceDenial(ip string) (bool, int) {
+	m.denialsMutex.Lock()
+	defer m.denialsMutex.Unlock()
+
+	now := time.Now()
+	count, exists := m.denials[ip]
+	if exists && now.Sub(count.since) < anonymousDenialInterval {
+		count.suppressed++
+		return false, 0
+	}
+
+	if !exists && len(m.denials) >= maxDenialSources {
+		for source, c := range m.denials {
+			if now.Sub(c.since) >= anonymousDenialInterval {
+				delete(m.denials, source)
+			}
+		}
+		if len(m.denials) >= maxDenialSources {
+			return false, 0 // Too many addresses at once; wait for some to age out
+		}
+	}
+	if m.denials == nil {
+		m.denials = make(map[string]*denialCount)
+	}
+
+	suppressed := 0
+	if exists {
+		suppressed = count.suppressed
+	}
+	m.denials[ip] = &denialCount{since: now}
+	return true, suppressed
+}
+
+// record writes an entry to the audit log, if there is one
+func (m *Middleware) record(entry audit.Entry) {
+	if m.auditLog == nil {
+		return
+	}
+	if entry.Identity == "" {
+		entry.Identity = "anonymous"
+	}
+	if err := m.auditLog.Record(entry); err != nil && m.logger != nil {
+		m.logger.LogError("Failed to write audit log", err)
+	}
+}
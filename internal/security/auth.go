@@ -0,0 +1,162 @@
+package security
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scopes an API key can carry
+const (
+	ScopeAdmin     = "admin"      // every scope
+	ScopeLogsRead  = "logs:read"  // history and deployment status
+	ScopeAuditRead = "audit:read" // the audit log
+	ScopeDeployAll = "deploy:*"   // deploy and cancel any app
+)
+
+// legacyKeyName identifies requests made with the single api_key
+const legacyKeyName = "API"
+
+// DeployScope returns the scope needed to deploy or cancel an app
+func DeployScope(app string) string {
+	return "deploy:" + app
+}
+
+// Identity is the API key or client certificate a request was
+// authenticated with
+type Identity struct {
+	Name       string
+	Scopes     []string
+	Credential string // "api_key", "api_keys" or "client certificate <subject>"
+}
+
+// Allows reports whether the identity carries scope, directly or through
+// admin or deploy:*
+func (id Identity) Allows(scope string) bool {
+	for _, granted := range id.Scopes {
+		switch {
+		case granted == scope, granted == ScopeAdmin:
+			return true
+		case granted == ScopeDeployAll && strings.HasPrefix(scope, "deploy:"):
+			return true
+		}
+	}
+	return false
+}
+
+// identityKey is the context key of a request's Identity
+type identityKey struct{}
+
+// IdentityFrom returns the identity AuthMiddleware attached to a request
+func IdentityFrom(r *http.Request) Identity {
+	identity, _ := r.Context().Value(identityKey{}).(Identity)
+	return identity
+}
+
+// RequireScope answers 403 and returns false unless the request's identity
+// carries scope
+func (m *Middleware) RequireScope(w http.ResponseWriter, r *http.Request, scope string) bool {
+	identity := IdentityFrom(r)
+	if identity.Allows(scope) {
+		return true
+	}
+	m.deny(w, r, identity, http.StatusForbidden, fmt.Sprintf("Forbidden: %s lacks scope %s", identity.Name, scope))
+	return false
+}
+
+// AuthMiddleware checks that a request comes with a client certificate
+// listed in [client_certs] or a valid API key, and that it carries scope.
+// With an empty scope any identity passes, for handlers that check scopes
+// themselves once they know which app a request is for.
+func (m *Middleware) AuthMiddleware(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, found := m.certIdentity(r)
+		if !found && m.config.Load().RequireClientCert {
+			m.deny(w, r, identity, http.StatusUnauthorized, "Unauthorized: client certificate required")
+			return
+		}
+		if !found {
+			token, given := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !given || token == "" {
+				m.deny(w, r, identity, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			var expired bool
+			identity, expired, found = m.authenticate(token)
+			if !found {
+				m.deny(w, r, identity, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			if expired {
+				m.deny(w, r, identity, http.StatusUnauthorized, "Unauthorized: API key expired")
+				return
+			}
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), identityKey{}, identity))
+		if scope != "" && !m.RequireScope(w, r, scope) {
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// authenticate looks up the key a token belongs to. Keys are compared by
+// their SHA-256 digests in constant time, and every key is compared, so
+// timing reveals neither the keys nor which one matched.
+func (m *Middleware) authenticate(token string) (identity Identity, expired, found bool) {
+	cfg := m.config.Load()
+	digest := sha256.Sum256([]byte(token))
+
+	if cfg.APIKey != "" {
+		legacy := sha256.Sum256([]byte(cfg.APIKey))
+		if subtle.ConstantTimeCompare(digest[:], legacy[:]) == 1 {
+			identity, found = Identity{Name: legacyKeyName, Scopes: []string{ScopeAdmin}, Credential: "api_key"}, true
+		}
+	}
+
+	for name, key := range cfg.APIKeys {
+		expected, err := key.Digest()
+		if err != nil {
+			continue
+		}
+		if subtle.ConstantTimeCompare(digest[:], expected) == 1 {
+			identity, found = Identity{Name: name, Scopes: key.Scopes, Credential: "api_keys"}, true
+			expired = !key.Expires.IsZero() && time.Now().After(key.Expires)
+		}
+	}
+	return identity, expired, found
+}
+
+// certIdentity looks up the [client_certs] entry of the client certificate
+// a request was made with. The TLS handshake has already verified the
+// certificate against tls_client_ca.
+func (m *Middleware) certIdentity(r *http.Request) (Identity, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return Identity{}, false
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+
+	subjects := []string{cert.Subject.CommonName}
+	subjects = append(subjects, cert.DNSNames...)
+	subjects = append(subjects, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		subjects = append(subjects, uri.String())
+	}
+
+	for name, clientCert := range m.config.Load().ClientCerts {
+		for _, subject := range subjects {
+			if subject != "" && slices.Contains(clientCert.Subjects, subject) {
+				return Identity{Name: name, Scopes: clientCert.Scopes, Credential: "client certificate " + subject}, true
+			}
+		}
+	}
+	return Identity{}, false
+}
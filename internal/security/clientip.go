@@ -0,0 +1,135 @@
+package security
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// maxWarnedPeers bounds how many untrusted peers are remembered as already
+// logged; past it the list starts over and peers may be logged again
+const maxWarnedPeers = 1024
+
+// clientIP resolves the address of the client behind a request. Only the
+// client_ip_header is read, and only when the request comes from one of
+// trusted_proxies: a proxy that sets one header passes the others on from
+// the client untouched. The chain is walked from the right, past every
+// trusted proxy, so an address a client puts in the header itself is never
+// taken for its own. It also returns how the address was found, for the logs.
+func (m *Middleware) clientIP(r *http.Request) (ip, source string) {
+	peer := remoteIP(r)
+	header := http.CanonicalHeaderKey(m.config.Load().ClientIPHeader)
+	chain := forwardedChain(r.Header, header)
+	if len(chain) == 0 {
+		return peer, "RemoteAddr"
+	}
+	if !m.isTrustedProxy(peer) {
+		if m.firstWarning(peer) {
+			m.logf("Ignoring %s from %s: not in trusted_proxies", header, peer)
+		}
+		return peer, fmt.Sprintf("RemoteAddr, %s ignored as %s is not a trusted proxy", header, peer)
+	}
+
+	hops := []string{peer}
+	for i := len(chain) - 1; i >= 0; i-- {
+		hop := parseHop(chain[i])
+		if hop == "" {
+			// Nothing left of an unusable entry can be trusted
+			last := hops[len(hops)-1]
+			return last, fmt.Sprintf("%s stopped at %q, using proxy %s", header, chain[i], last)
+		}
+		if i == 0 || !m.isTrustedProxy(hop) {
+			return hop, fmt.Sprintf("%s via %s", header, strings.Join(hops, ", "))
+		}
+		hops = append(hops, hop)
+	}
+	return peer, "RemoteAddr"
+}
+
+// firstWarning reports whether an ignored forwarded header from peer has
+// not been logged yet, and remembers that it now has
+func (m *Middleware) firstWarning(peer string) bool {
+	m.warnedMutex.Lock()
+	defer m.warnedMutex.Unlock()
+
+	if m.warned[peer] {
+		return false
+	}
+	if m.warned == nil || len(m.warned) >= maxWarnedPeers {
+		m.warned = make(map[string]bool)
+	}
+	m.warned[peer] = true
+	return true
+}
+
+// isTrustedProxy checks if an IP is in trusted_proxies
+func (m *Middleware) isTrustedProxy(ip string) bool {
+	for _, proxy := range m.config.Load().TrustedProxies {
+		if m.matchesIPOrCIDR(ip, proxy) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the address of the peer that sent a request
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// forwardedChain returns the client addresses recorded by proxies in one
+// header (RFC 7239 Forwarded, X-Forwarded-For or X-Real-IP), oldest first
+func forwardedChain(header http.Header, name string) []string {
+	var chain []string
+	switch name {
+	case "Forwarded":
+		for _, value := range header.Values(name) {
+			for _, element := range strings.Split(value, ",") {
+				for _, pair := range strings.Split(element, ";") {
+					key, node, found := strings.Cut(strings.TrimSpace(pair), "=")
+					if found && strings.EqualFold(key, "for") {
+						chain = append(chain, strings.Trim(node, `"`))
+					}
+				}
+			}
+		}
+	case "X-Forwarded-For":
+		for _, value := range header.Values(name) {
+			for _, hop := range strings.Split(value, ",") {
+				chain = append(chain, strings.TrimSpace(hop))
+			}
+		}
+	case "X-Real-Ip":
+		if xri := strings.TrimSpace(header.Get(name)); xri != "" {
+			chain = []string{xri}
+		}
+	}
+	return chain
+}
+
+// parseHop extracts the IP address from a forwarded entry such as
+// "192.0.2.60", "192.0.2.60:8080" or "[2001:db8::17]:4711". It returns an
+// empty string for "unknown", obfuscated identifiers and anything else
+// that isn't an address.
+func parseHop(hop string) string {
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		hop = host
+	}
+	ip := net.ParseIP(strings.Trim(hop, "[]"))
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// logf logs an informational message if the middleware has a logger
+func (m *Middleware) logf(format string, args ...interface{}) {
+	if m.logger != nil {
+		m.logger.LogInfo(fmt.Sprintf(format, args...))
+	}
+}
@@ -5,15 +5,26 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ktappdev/cicd-thing/internal/audit"
 	"github.com/ktappdev/cicd-thing/internal/config"
+	"github.com/ktappdev/cicd-thing/internal/logger"
 )
 
 // Middleware provides security middleware functions
 type Middleware struct {
-	config *config.Config
+	config      atomic.Pointer[config.Config]
 	rateLimiter *RateLimiter
+	logger      *logger.Logger
+	auditLog    *audit.Log
+
+	warnedMutex sync.Mutex
+	warned      map[string]bool // peers whose forwarded headers were ignored
+
+	denialsMutex sync.Mutex
+	denials      map[string]*denialCount // anonymous refusals per source IP
 }
 
 // RateLimiter provides simple in-memory rate limiting
@@ -30,11 +41,20 @@ type ClientInfo struct {
 }
 
 // New creates a new security middleware instance
-func New(cfg *config.Config) *Middleware {
-	return &Middleware{
-		config: cfg,
+func New(cfg *config.Config, logger *logger.Logger, auditLog *audit.Log) *Middleware {
+	m := &Middleware{
 		rateLimiter: NewRateLimiter(),
+		logger:      logger,
+		auditLog:    auditLog,
 	}
+	m.config.Store(cfg)
+	return m
+}
+
+// Reload switches the middleware to a new configuration, e.g. a rotated
+// API key or a changed IP allowlist
+func (m *Middleware) Reload(cfg *config.Config) {
+	m.config.Store(cfg)
 }
 
 // NewRateLimiter creates a new rate limiter
@@ -54,29 +74,15 @@ func NewRateLimiter() *RateLimiter {
 func (m *Middleware) IPAllowlistMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// If no allowlist is configured, allow all IPs
-		if len(m.config.IPAllowlist) == 0 {
+		if len(m.config.Load().IPAllowlist) == 0 {
 			next(w, r)
 			return
 		}
 
-		clientIP := getClientIP(r)
+		clientIP, source := m.clientIP(r)
 		if !m.isIPAllowed(clientIP) {
-			http.Error(w, "Forbidden: IP not allowed", http.StatusForbidden)
-			return
-		}
-
-		next(w, r)
-	}
-}
-
-// AuthMiddleware checks API key authentication
-func (m *Middleware) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		expectedAuth := "Bearer " + m.config.APIKey
-
-		if authHeader != expectedAuth {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			m.logf("Denied %s %s: %s is not in ip_allowlist (client IP from %s)", r.Method, r.URL.Path, clientIP, source)
+			m.deny(w, r, Identity{}, http.StatusForbidden, "Forbidden: IP not allowed")
 			return
 		}
 
@@ -84,33 +90,9 @@ func (m *Middleware) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// getClientIP extracts the client IP from the request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (for proxies)
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		// X-Forwarded-For can contain multiple IPs, take the first one
-		ips := strings.Split(xff, ",")
-		return strings.TrimSpace(ips[0])
-	}
-
-	// Check X-Real-IP header
-	xri := r.Header.Get("X-Real-IP")
-	if xri != "" {
-		return strings.TrimSpace(xri)
-	}
-
-	// Fall back to RemoteAddr
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
-	}
-	return ip
-}
-
 // isIPAllowed checks if an IP is in the allowlist
 func (m *Middleware) isIPAllowed(clientIP string) bool {
-	for _, allowedIP := range m.config.IPAllowlist {
+	for _, allowedIP := range m.config.Load().IPAllowlist {
 		if m.matchesIPOrCIDR(clientIP, allowedIP) {
 			return true
 		}
@@ -138,7 +120,7 @@ func (m *Middleware) matchesIPOrCIDR(clientIP, allowedIP string) bool {
 // Allows 30 requests per minute per IP (reasonable for human log viewing)
 func (m *Middleware) RateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		clientIP := getClientIP(r)
+		clientIP, _ := m.clientIP(r)
 		
 		if !m.rateLimiter.Allow(clientIP, 30, time.Minute) {
 			http.Error(w, "Rate limit exceeded. Please wait before making more requests.", http.StatusTooManyRequests)
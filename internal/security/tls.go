@@ -0,0 +1,118 @@
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ktappdev/cicd-thing/internal/config"
+	"github.com/ktappdev/cicd-thing/internal/logger"
+)
+
+// certCheckInterval is how often the TLS files are checked for changes
+const certCheckInterval = 10 * time.Second
+
+// LoadTLS reads the certificate, key and client CAs named by cfg into a
+// TLS configuration. A client certificate is optional at the TLS level,
+// so webhooks work without one; AuthMiddleware decides what it's worth.
+func LoadTLS(cfg *config.Config) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.TLSClientCA != "" {
+		pem, err := os.ReadFile(cfg.TLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls_client_ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls_client_ca %s contains no certificates", cfg.TLSClientCA)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// CertReloader serves the TLS configuration of the listener. It loads the
+// files again when they change on disk or the configuration is reloaded,
+// and keeps the previous certificate if the new files don't load, e.g.
+// while a renewal has replaced the certificate but not yet the key.
+type CertReloader struct {
+	mutex     sync.Mutex
+	config    *config.Config
+	modTimes  []time.Time
+	checked   time.Time
+	tlsConfig *tls.Config
+	logger    *logger.Logger
+}
+
+// NewCertReloader loads the TLS files named by cfg
+func NewCertReloader(cfg *config.Config, logger *logger.Logger) (*CertReloader, error) {
+	c := &CertReloader{logger: logger}
+	if err := c.Reload(cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload loads the TLS files named by cfg, even if they haven't changed
+func (c *CertReloader) Reload(cfg *config.Config) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.load(cfg)
+}
+
+// GetConfigForClient hands each TLS handshake the current configuration,
+// first loading the files again if they changed
+func (c *CertReloader) GetConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if time.Since(c.checked) >= certCheckInterval {
+		c.checked = time.Now()
+		if !slices.EqualFunc(c.modTimes, modTimes(c.config), time.Time.Equal) {
+			if err := c.load(c.config); err != nil {
+				c.logger.LogError("Failed to reload TLS certificate, keeping the current one", err)
+			} else {
+				c.logger.LogInfo("TLS certificate reloaded from " + c.config.TLSCert)
+			}
+		}
+	}
+	return c.tlsConfig, nil
+}
+
+// load reads the TLS files; the caller holds the mutex
+func (c *CertReloader) load(cfg *config.Config) error {
+	times := modTimes(cfg)
+	tlsConfig, err := LoadTLS(cfg)
+	if err != nil {
+		return err
+	}
+	c.config, c.modTimes, c.tlsConfig, c.checked = cfg, times, tlsConfig, time.Now()
+	return nil
+}
+
+// modTimes returns when each TLS file was last modified, zero for files
+// that can't be read
+func modTimes(cfg *config.Config) []time.Time {
+	var times []time.Time
+	for _, file := range []string{cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA} {
+		var modTime time.Time
+		if info, err := os.Stat(file); err == nil {
+			modTime = info.ModTime()
+		}
+		times = append(times, modTime)
+	}
+	return times
+}
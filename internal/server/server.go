@@ -2,55 +2,164 @@ package server
 
 import (
 	"bufio"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/ktappdev/cicd-thing/internal/audit"
 	"github.com/ktappdev/cicd-thing/internal/config"
 	"github.com/ktappdev/cicd-thing/internal/deployment"
+	"github.com/ktappdev/cicd-thing/internal/history"
 	"github.com/ktappdev/cicd-thing/internal/logger"
+	"github.com/ktappdev/cicd-thing/internal/mapping"
 	"github.com/ktappdev/cicd-thing/internal/security"
+	"github.com/ktappdev/cicd-thing/internal/validate"
 	"github.com/ktappdev/cicd-thing/internal/webhook"
 )
 
 // Server represents the HTTP server
 type Server struct {
-	config         *config.Config
+	config         atomic.Pointer[config.Config]
 	webhookHandler *webhook.Handler
 	security       *security.Middleware
 	executor       *deployment.Executor
 	logger         *logger.Logger
+	history        history.Store
+	auditLog       *audit.Log
+	reloadMutex    sync.Mutex
+	onReload       []func(*config.Config)
+	certs          *security.CertReloader // nil when serving plain HTTP
 }
 
 // New creates a new server instance
-func New(cfg *config.Config, executor *deployment.Executor, logger *logger.Logger) *Server {
-	return &Server{
-		config:         cfg,
-		webhookHandler: webhook.New(cfg, executor),
-		security:       security.New(cfg),
+func New(cfg *config.Config, executor *deployment.Executor, logger *logger.Logger, historyStore history.Store, auditLog *audit.Log, deliveries *webhook.DeliveryLog) *Server {
+	securityMiddleware := security.New(cfg, logger, auditLog)
+	s := &Server{
+		webhookHandler: webhook.New(cfg, executor, logger, deliveries, securityMiddleware),
+		security:       securityMiddleware,
 		executor:       executor,
 		logger:         logger,
+		history:        historyStore,
+		auditLog:       auditLog,
 	}
+	s.config.Store(cfg)
+	return s
+}
+
+// OnReload registers a component outside the server that has to switch to
+// the new configuration when it is reloaded
+func (s *Server) OnReload(reload func(*config.Config)) {
+	s.onReload = append(s.onReload, reload)
+}
+
+// Reload reads the configuration file again and, once it has passed the
+// same checks as "cicd-thing validate", swaps it into the executor, webhook
+// handler, security middleware and registered components, and reloads the
+// TLS certificate.
+// Deployments already queued or running finish with the configuration
+// they were accepted under. It returns what changed; on error the old
+// configuration stays in effect.
+func (s *Server) Reload() ([]string, error) {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	cfg, err := config.LoadFile(s.config.Load().Path)
+	if err != nil {
+		return nil, err
+	}
+	if problems := validate.Check(cfg); len(problems) > 0 {
+		messages := make([]string, len(problems))
+		for i, problem := range problems {
+			messages[i] = problem.Setting + ": " + problem.Message
+		}
+		return nil, fmt.Errorf("%d problem(s) found: %s", len(problems), strings.Join(messages, "; "))
+	}
+
+	previous := s.config.Load()
+	changes := config.Diff(previous, cfg)
+	if s.certs != nil && cfg.TLSCert != "" {
+		if err := s.certs.Reload(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if (s.certs != nil) != (cfg.TLSCert != "") {
+		changes = append(changes, "switching between HTTP and HTTPS takes effect after a restart")
+	}
+	s.executor.Reload(cfg)
+	s.webhookHandler.Reload(cfg)
+	s.security.Reload(cfg)
+	for _, reload := range s.onReload {
+		reload(cfg)
+	}
+	s.config.Store(cfg)
+
+	// Notes already logged for the previous configuration aren't repeated
+	for _, note := range cfg.Notes() {
+		if !slices.Contains(previous.Notes(), note) {
+			s.logger.LogInfo("Config: " + note)
+		}
+	}
+	if len(changes) == 0 {
+		s.logger.LogInfo("Configuration reloaded, nothing changed")
+	}
+	for _, change := range changes {
+		s.logger.LogInfo("Configuration reloaded: " + change)
+	}
+	return changes, nil
 }
 
 // Start starts the HTTP server
 func (s *Server) Start() error {
 	// Set up routes with security middleware
 	http.HandleFunc("/webhook", s.security.IPAllowlistMiddleware(s.webhookHandler.HandleWebhook))
+	http.HandleFunc("/hooks/generic/{app}", s.security.IPAllowlistMiddleware(s.webhookHandler.HandleGeneric))
 	http.HandleFunc("/health", s.handleHealth)
 	http.HandleFunc("/status", s.handleStatus)
-	http.HandleFunc("/deploy", s.security.IPAllowlistMiddleware(s.security.AuthMiddleware(s.handleManualDeploy)))
+	http.HandleFunc("/deploy", s.security.IPAllowlistMiddleware(s.security.AuthMiddleware("", s.handleManualDeploy)))
 	http.HandleFunc("/logs", s.security.IPAllowlistMiddleware(s.security.RateLimitMiddleware(s.handleLogs)))
+	http.HandleFunc("/history", s.security.IPAllowlistMiddleware(s.security.AuthMiddleware(security.ScopeLogsRead, s.handleHistory)))
+	http.HandleFunc("/deployments", s.security.IPAllowlistMiddleware(s.security.AuthMiddleware(security.ScopeLogsRead, s.handleListDeployments)))
+	http.HandleFunc("/deployments/{id}", s.security.IPAllowlistMiddleware(s.security.AuthMiddleware(security.ScopeLogsRead, s.handleGetDeployment)))
+	http.HandleFunc("/deployments/{id}/stream", s.security.IPAllowlistMiddleware(s.security.AuthMiddleware(security.ScopeLogsRead, s.handleStreamDeployment)))
+	http.HandleFunc("/deployments/{id}/cancel", s.security.IPAllowlistMiddleware(s.security.AuthMiddleware("", s.handleCancelDeployment)))
+	http.HandleFunc("/admin/reload", s.security.IPAllowlistMiddleware(s.security.AuthMiddleware(security.ScopeAdmin, s.handleReload)))
+	http.HandleFunc("/audit", s.security.IPAllowlistMiddleware(s.security.AuthMiddleware(security.ScopeAuditRead, s.handleAudit)))
+	http.HandleFunc("/audit/verify", s.security.IPAllowlistMiddleware(s.security.AuthMiddleware(security.ScopeAuditRead, s.handleAuditVerify)))
 
 	// Start server
-	addr := ":" + s.config.Port
-	log.Printf("Starting server on port %s", s.config.Port)
-	return http.ListenAndServe(addr, nil)
+	cfg := s.config.Load()
+	addr := ":" + cfg.Port
+	if cfg.TLSCert == "" {
+		log.Printf("Starting server on port %s", cfg.Port)
+		return http.ListenAndServe(addr, nil)
+	}
+
+	// Hold off reloads so none is missed while the certificate loads
+	s.reloadMutex.Lock()
+	certs, err := security.NewCertReloader(s.config.Load(), s.logger)
+	s.certs = certs
+	s.reloadMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:      addr,
+		TLSConfig: &tls.Config{GetConfigForClient: certs.GetConfigForClient},
+	}
+	log.Printf("Starting HTTPS server on port %s", cfg.Port)
+	return server.ListenAndServeTLS("", "")
 }
 
 // handleHealth handles health check requests
@@ -61,25 +170,26 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get system information
+	cfg := s.config.Load()
 	health := map[string]interface{}{
 		"status":  "healthy",
 		"service": "cicd-thing",
 		"version": "1.0.0",
 		"uptime":  "running", // Could be enhanced with actual uptime
 		"config": map[string]interface{}{
-			"port":              s.config.Port,
-			"concurrency_limit": s.config.ConcurrencyLimit,
-			"timeout_seconds":   s.config.TimeoutSeconds,
-			"branch_filter":     s.config.BranchFilter,
-			"dry_run":           s.config.DryRun,
-			"repositories":      len(s.config.RepoMap),
+			"port":              cfg.Port,
+			"concurrency_limit": cfg.ConcurrencyLimit,
+			"timeout_seconds":   cfg.TimeoutSeconds,
+			"branch_filter":     cfg.BranchFilter,
+			"dry_run":           cfg.DryRun,
+			"repositories":      len(cfg.RepoMap),
 		},
 		"features": map[string]bool{
 			"webhook_listener":  true,
 			"manual_deployment": true,
-			"rollback_support":  len(s.config.RollbackCommands) > 0,
-			"ip_allowlist":      len(s.config.IPAllowlist) > 0,
-			"notifications":     s.config.NotifyOnRollback,
+			"rollback_support":  len(cfg.RollbackCommands) > 0,
+			"ip_allowlist":      len(cfg.IPAllowlist) > 0,
+			"notifications":     cfg.NotifyOnRollback,
 		},
 	}
 
@@ -103,21 +213,36 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Count queued and running deployments
+	active, queued, pendingChecks := 0, 0, 0
+	for _, d := range s.executor.List() {
+		switch d.Status {
+		case deployment.StatusQueued:
+			queued++
+		case deployment.StatusPendingChecks:
+			pendingChecks++
+		default:
+			active++
+		}
+	}
+
 	// Get deployment status information
+	cfg := s.config.Load()
 	status := map[string]interface{}{
 		"service": "cicd-thing",
 		"status":  "running",
 		"deployments": map[string]interface{}{
-			"active":    0, // Could be enhanced to show actual active deployments
-			"queued":    0, // Could be enhanced to show queue length
-			"completed": 0, // Could be enhanced to show completed count
+			"active":         active,
+			"queued":         queued,
+			"pending_checks": pendingChecks,
+			"completed":      len(s.history.Query(history.Filter{})),
 		},
-		"repositories": s.config.RepoMap,
+		"repositories": cfg.RepoMap,
 		"configuration": map[string]interface{}{
-			"concurrency_limit": s.config.ConcurrencyLimit,
-			"timeout_seconds":   s.config.TimeoutSeconds,
-			"branch_filter":     s.config.BranchFilter,
-			"dry_run":           s.config.DryRun,
+			"concurrency_limit": cfg.ConcurrencyLimit,
+			"timeout_seconds":   cfg.TimeoutSeconds,
+			"branch_filter":     cfg.BranchFilter,
+			"dry_run":           cfg.DryRun,
 		},
 	}
 
@@ -142,6 +267,7 @@ func (s *Server) handleManualDeploy(w http.ResponseWriter, r *http.Request) {
 
 	// Parse query parameters
 	repo := r.URL.Query().Get("repo")
+	app := r.URL.Query().Get("app")
 	branch := r.URL.Query().Get("branch")
 	commit := r.URL.Query().Get("commit")
 
@@ -152,7 +278,7 @@ func (s *Server) handleManualDeploy(w http.ResponseWriter, r *http.Request) {
 
 	// Set defaults
 	if branch == "" {
-		branch = s.config.BranchFilter
+		branch = s.config.Load().BranchFilter
 		if branch == "" {
 			branch = "main"
 		}
@@ -161,8 +287,29 @@ func (s *Server) handleManualDeploy(w http.ResponseWriter, r *http.Request) {
 		commit = "HEAD"
 	}
 
-	// Get local path for repository
-	localPath, err := s.executor.GetLocalPath(repo)
+	// A monorepo deploys several apps, so the caller has to pick one
+	apps := s.executor.GetApps(repo)
+	if app == "" {
+		if len(apps) > 1 {
+			http.Error(w, fmt.Sprintf("Repository deploys several apps, specify one of: %s", strings.Join(apps, ", ")), http.StatusBadRequest)
+			return
+		}
+		app = apps[0]
+	} else if !slices.Contains(apps, app) {
+		http.Error(w, fmt.Sprintf("App %s is not deployed from %s", app, repo), http.StatusBadRequest)
+		return
+	}
+	if !s.security.RequireScope(w, r, security.DeployScope(app)) {
+		return
+	}
+	identity := security.IdentityFrom(r)
+
+	// Get the environment and local path for the repository and branch
+	environment, localPath, err := s.executor.ResolveEnvironment(repo, app, branch)
+	if errors.Is(err, mapping.ErrNoEnvironment) {
+		http.Error(w, fmt.Sprintf("No environment configured for branch %s", branch), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Repository not configured: %v", err), http.StatusBadRequest)
 		return
@@ -170,28 +317,358 @@ func (s *Server) handleManualDeploy(w http.ResponseWriter, r *http.Request) {
 
 	// Create deployment request
 	depReq := &deployment.Request{
-		Repository: repo,
-		Branch:     branch,
-		Commit:     commit,
-		Message:    "Manual deployment via API",
-		Author:     "API",
-		LocalPath:  localPath,
-		Manual:     true,
+		Repository:  repo,
+		App:         app,
+		Branch:      branch,
+		Environment: environment,
+		Commit:      commit,
+		Message:     "Manual deployment via API",
+		Author:      identity.Name,
+		LocalPath:   localPath,
+		Manual:      true,
 	}
 
 	// Log manual trigger
-	s.logger.LogManualTrigger(repo, branch, commit)
+	s.logger.LogManualTrigger(repo, branch, commit, identity.Name)
 
 	// Trigger deployment
+	audited := audit.Entry{Action: audit.ActionDeploy, App: app, Detail: fmt.Sprintf("%s@%s commit %s", repo, branch, commit)}
 	if err := s.executor.Deploy(depReq); err != nil {
+		audited.Outcome, audited.Detail = audit.OutcomeFailure, audited.Detail+": "+err.Error()
+		s.security.Audit(r, audited)
 		http.Error(w, fmt.Sprintf("Failed to trigger deployment: %v", err), http.StatusInternalServerError)
 		return
 	}
+	audited.Outcome, audited.RequestID = audit.OutcomeSuccess, depReq.ID
+	s.security.Audit(r, audited)
+
+	writeJSON(w, map[string]interface{}{
+		"status":      "success",
+		"message":     "Manual deployment triggered",
+		"id":          depReq.ID,
+		"repository":  repo,
+		"app":         app,
+		"branch":      branch,
+		"environment": environment,
+		"commit":      commit,
+	})
+}
+
+// handleHistory handles deployment history queries
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	// Single deployment lookup
+	if id := query.Get("id"); id != "" {
+		record, exists := s.history.Get(id)
+		if !exists {
+			http.Error(w, "Deployment not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, record)
+		return
+	}
+
+	filter := history.Filter{
+		Repository:  query.Get("repo"),
+		Branch:      query.Get("branch"),
+		App:         query.Get("app"),
+		Environment: query.Get("environment"),
+		Status:      deployment.Status(strings.ToUpper(query.Get("status"))),
+		Limit:       50,
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > 1000 {
+			http.Error(w, "Invalid limit: must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	for param, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid %s: expected RFC3339 timestamp", param), http.StatusBadRequest)
+			return
+		}
+		*target = parsed
+	}
+
+	records := s.history.Query(filter)
+	if records == nil {
+		records = []*history.Record{}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"count":       len(records),
+		"deployments": records,
+	})
+}
+
+// handleListDeployments lists queued and running deployments
+func (s *Server) handleListDeployments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deployments := s.executor.List()
+	writeJSON(w, map[string]interface{}{
+		"count":       len(deployments),
+		"deployments": deployments,
+	})
+}
+
+// handleGetDeployment returns a single deployment, live if it is still
+// queued or running and from history otherwise
+func (s *Server) handleGetDeployment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.PathValue("id")
+	if d, exists := s.executor.Get(id); exists {
+		writeJSON(w, d)
+		return
+	}
+	if record, exists := s.history.Get(id); exists {
+		writeJSON(w, record)
+		return
+	}
+
+	http.Error(w, "Deployment not found", http.StatusNotFound)
+}
+
+// handleCancelDeployment cancels a queued or running deployment
+func (s *Server) handleCancelDeployment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.PathValue("id")
+	audited := audit.Entry{Action: audit.ActionCancel, RequestID: id}
+	if d, exists := s.executor.Get(id); exists {
+		if !s.security.RequireScope(w, r, security.DeployScope(d.App)) {
+			return
+		}
+		audited.App = d.App
+	}
+	if err := s.executor.Cancel(id); err != nil {
+		audited.Outcome, audited.Detail = audit.OutcomeFailure, err.Error()
+		s.security.Audit(r, audited)
+		if _, finished := s.history.Get(id); finished {
+			http.Error(w, "Deployment already finished", http.StatusConflict)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to cancel deployment: %v", err), http.StatusNotFound)
+		return
+	}
+
+	s.logger.LogInfo(fmt.Sprintf("Cancellation of deployment %s requested by %s", id, security.IdentityFrom(r).Name))
+	audited.Outcome = audit.OutcomeSuccess
+	s.security.Audit(r, audited)
+
+	writeJSON(w, map[string]interface{}{
+		"status":  "success",
+		"message": "Deployment cancellation requested",
+		"id":      id,
+	})
+}
+
+// handleReload reloads the configuration file without a restart
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.logger.LogInfo("Configuration reload requested by " + security.IdentityFrom(r).Name)
+	changes, err := s.Reload()
+	if err != nil {
+		s.security.Audit(r, audit.Entry{Action: audit.ActionReload, Outcome: audit.OutcomeFailure, Detail: err.Error()})
+		s.logger.LogError("Configuration reload failed", err)
+		http.Error(w, fmt.Sprintf("Failed to reload configuration: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.security.Audit(r, audit.Entry{Action: audit.ActionReload, Outcome: audit.OutcomeSuccess, Detail: fmt.Sprintf("%d change(s)", len(changes))})
+	if changes == nil {
+		changes = []string{}
+	}
+	writeJSON(w, map[string]interface{}{
+		"status":  "success",
+		"message": "Configuration reloaded",
+		"changes": changes,
+	})
+}
+
+// handleAudit handles audit log queries
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Identity:  query.Get("identity"),
+		Action:    query.Get("action"),
+		Outcome:   query.Get("outcome"),
+		App:       query.Get("app"),
+		RequestID: query.Get("request_id"),
+		Limit:     100,
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > 1000 {
+			http.Error(w, "Invalid limit: must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	for param, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid %s: expected RFC3339 timestamp", param), http.StatusBadRequest)
+			return
+		}
+		*target = parsed
+	}
+
+	entries, err := s.auditLog.Query(filter)
+	if err != nil {
+		s.logger.LogError("Failed to read audit log", err)
+		http.Error(w, "Failed to read audit log", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []*audit.Entry{}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"count":   len(entries),
+		"entries": entries,
+	})
+}
+
+// handleAuditVerify checks the hash chain of the audit log file
+func (s *Server) handleAuditVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	verified, err := s.auditLog.Verify()
+	response := map[string]interface{}{
+		"valid":    err == nil,
+		"verified": verified,
+	}
+	if err != nil {
+		s.logger.LogError("Audit log verification failed", err)
+		response["error"] = err.Error()
+	}
+	writeJSON(w, response)
+}
+
+// handleStreamDeployment streams deployment output as Server-Sent Events.
+// Buffered output is replayed first, then new lines follow until the
+// deployment finishes. Finished deployments are replayed from history.
+func (s *Server) handleStreamDeployment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	id := r.PathValue("id")
+	buffer, live := s.executor.Stream(id)
+	record, finished := s.history.Get(id)
+	if !live && !finished {
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if !live {
+		for _, line := range strings.Split(strings.TrimRight(record.Output, "\n"), "\n") {
+			writeEvent(w, "", line)
+		}
+		writeEvent(w, "end", string(record.Status))
+		flusher.Flush()
+		return
+	}
+
+	backlog, lines, unsubscribe := buffer.Subscribe()
+	defer unsubscribe()
+
+	for _, line := range backlog {
+		writeEvent(w, "", line)
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case line, open := <-lines:
+			if !open {
+				writeEvent(w, "end", string(buffer.Status()))
+				flusher.Flush()
+				return
+			}
+			writeEvent(w, "", line)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes a single Server-Sent Event
+func writeEvent(w http.ResponseWriter, event, data string) {
+	if event != "" {
+		fmt.Fprintf(w, "event: %s\n", event)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", strings.ReplaceAll(data, "\r", ""))
+}
+
+// writeJSON writes v as a JSON response with status 200
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Failed to generate response", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	response := fmt.Sprintf(`{"status":"success","message":"Manual deployment triggered","repository":"%s","branch":"%s","commit":"%s"}`, repo, branch, commit)
-	w.Write([]byte(response))
+	w.Write(jsonData)
 }
 
 // handleLogs handles log viewer requests
@@ -223,14 +700,17 @@ func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
 
-	// Render HTML template
+	// Render HTML template. Active deployments are not listed here: the
+	// page loads them from /deployments, which needs logs:read.
 	tmpl := template.Must(template.New("logs").Parse(logViewerHTML))
 	data := struct {
-		Logs  []string
-		Limit int
+		Logs   []string
+		Limit  int
+		Follow string
 	}{
-		Logs:  logLines,
-		Limit: limit,
+		Logs:   logLines,
+		Limit:  limit,
+		Follow: r.URL.Query().Get("follow"),
 	}
 
 	if err := tmpl.Execute(w, data); err != nil {
@@ -364,6 +844,14 @@ const logViewerHTML = `
         .warning {
             color: #fbbf24;
         }
+        .live-container {
+            display: none;
+            margin-bottom: 20px;
+        }
+        .live-container h2 {
+            font-size: 16px;
+            margin: 0 0 10px 0;
+        }
     </style>
 </head>
 <body>
@@ -379,8 +867,17 @@ const logViewerHTML = `
                 <option value="200" {{if eq .Limit 200}}selected{{end}}>200 lines</option>
             </select>
             <button onclick="refreshLogs()">🔄 Refresh</button>
+            <button id="show-deployments" onclick="loadDeployments()">📋 Active deployments</button>
+            <label for="deployment" class="follow" hidden>Follow:</label>
+            <select id="deployment" class="follow" hidden></select>
+            <button class="follow" onclick="followDeployment(document.getElementById('deployment').value)" hidden>▶️ Follow live</button>
         </div>
     </div>
+
+    <div class="live-container" id="live-container">
+        <h2 id="live-title"></h2>
+        <div class="log-container" id="live-output"></div>
+    </div>
     
     <div class="log-container">
         {{range .Logs}}
@@ -402,8 +899,109 @@ const logViewerHTML = `
             window.location.href = url.toString();
         }
         
-        // Auto-refresh every 30 seconds
-        setInterval(refreshLogs, 30000);
+        let refreshTimer = setInterval(refreshLogs, 30000);
+
+        // authorizedFetch requests an endpoint that needs an API key with
+        // the logs:read scope, which is asked for once and kept for this
+        // browser tab
+        async function authorizedFetch(url) {
+            const open = key => fetch(url, {headers: key ? {'Authorization': 'Bearer ' + key} : {}});
+            let response = await open(sessionStorage.getItem('apiKey'));
+            if (response.status === 401 || response.status === 403) {
+                const key = prompt('API key with the logs:read scope');
+                sessionStorage.setItem('apiKey', key || '');
+                response = await open(key);
+            }
+            return response;
+        }
+
+        // loadDeployments lists the queued and running deployments to follow
+        async function loadDeployments() {
+            const button = document.getElementById('show-deployments');
+            const response = await authorizedFetch('/deployments');
+            if (!response.ok) {
+                button.textContent = '📋 Active deployments: ' + (await response.text()).trim();
+                return;
+            }
+            const {deployments} = await response.json();
+            if (deployments.length === 0) {
+                button.textContent = '📋 No active deployments';
+                return;
+            }
+
+            const select = document.getElementById('deployment');
+            select.innerHTML = '';
+            for (const d of deployments) {
+                const option = document.createElement('option');
+                option.value = d.id;
+                option.textContent = d.repository + ' (' + d.branch + ') - ' + d.status;
+                select.appendChild(option);
+            }
+            button.hidden = true;
+            document.querySelectorAll('.follow').forEach(element => element.hidden = false);
+        }
+
+        // followDeployment streams a deployment's output live; auto-refresh
+        // is paused while following so the stream isn't interrupted
+        async function followDeployment(id) {
+            if (!id) {
+                return;
+            }
+            clearInterval(refreshTimer);
+
+            const container = document.getElementById('live-container');
+            const output = document.getElementById('live-output');
+            const title = document.getElementById('live-title');
+            container.style.display = 'block';
+            output.innerHTML = '';
+            title.className = '';
+            title.textContent = 'Following ' + id;
+
+            const response = await authorizedFetch('/deployments/' + encodeURIComponent(id) + '/stream');
+            if (!response.ok) {
+                title.textContent = id + ': ' + (await response.text());
+                title.className = 'error';
+                refreshTimer = setInterval(refreshLogs, 30000);
+                return;
+            }
+
+            // Read the Server-Sent Events by hand, since EventSource
+            // can't send the API key
+            const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+            let pending = '';
+            let event = '';
+            for (;;) {
+                const {value, done} = await reader.read();
+                if (done) {
+                    break;
+                }
+                pending += value;
+                let newline;
+                while ((newline = pending.indexOf('\n')) >= 0) {
+                    const line = pending.slice(0, newline);
+                    pending = pending.slice(newline + 1);
+                    if (line.startsWith('event: ')) {
+                        event = line.slice(7);
+                    } else if (line.startsWith('data: ') && event === 'end') {
+                        title.textContent = id + ' finished: ' + line.slice(6);
+                        title.className = line.slice(6) === 'SUCCESS' ? 'success' : 'error';
+                    } else if (line.startsWith('data: ')) {
+                        const entry = document.createElement('div');
+                        entry.className = 'log-line';
+                        entry.textContent = line.slice(6);
+                        output.appendChild(entry);
+                        output.scrollTop = output.scrollHeight;
+                    } else if (line === '') {
+                        event = '';
+                    }
+                }
+            }
+            refreshTimer = setInterval(refreshLogs, 30000);
+        }
+
+        {{if .Follow}}
+        followDeployment({{.Follow}});
+        {{end}}
     </script>
 </body>
 </html>
@@ -0,0 +1,122 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ktappdev/cicd-thing/internal/config"
+	"github.com/ktappdev/cicd-thing/internal/deployment"
+	"github.com/ktappdev/cicd-thing/internal/mapping"
+)
+
+// Explain prints what a push to target ("repo@branch") would do for each
+// app of the repository: where it deploys, which steps run in which order
+// and what rolls it back
+func Explain(cfg *config.Config, target string, out io.Writer) error {
+	repo, branch, ok := strings.Cut(target, "@")
+	if !ok || repo == "" || branch == "" {
+		return fmt.Errorf("--explain expects repo@branch, got %q", target)
+	}
+	branch = strings.TrimPrefix(branch, "refs/heads/")
+
+	mapper := mapping.New(cfg)
+	if _, err := mapper.GetLocalPath(repo); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "A push to %s of %s:\n", branch, repo)
+	if cfg.DryRun {
+		fmt.Fprintln(out, "  (dry_run is on, so nothing would actually be executed)")
+	}
+
+	for _, app := range mapper.GetApps(repo) {
+		fmt.Fprintf(out, "\nApp %s\n", app)
+		if err := explainApp(cfg, mapper, repo, app, branch, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// explainApp prints the deployment of one app for a branch
+func explainApp(cfg *config.Config, mapper *mapping.Mapper, repo, app, branch string, out io.Writer) error {
+	env, err := mapper.ResolveEnvironment(app, branch)
+	if errors.Is(err, mapping.ErrNoEnvironment) {
+		fmt.Fprintf(out, "  Not deployed: no environment of %s matches branch %s\n", app, branch)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if env == nil && cfg.BranchFilter != "" && branch != cfg.BranchFilter {
+		fmt.Fprintf(out, "  Not deployed: branch_filter is %q\n", cfg.BranchFilter)
+		return nil
+	}
+
+	localPath, err := mapper.GetEnvironmentPath(repo, app, env)
+	if err != nil {
+		return err
+	}
+
+	req := &deployment.Request{Repository: repo, App: app, Branch: branch, LocalPath: localPath}
+	if env != nil {
+		req.Environment = env.Name
+		fmt.Fprintf(out, "  Environment: %s\n", env.Name)
+	}
+	fmt.Fprintf(out, "  Directory:   %s\n", localPath)
+
+	if monorepoApp, exists := mapper.GetMonorepoApp(repo, app); exists && len(monorepoApp.Include)+len(monorepoApp.Exclude) > 0 {
+		fmt.Fprintf(out, "  Only if changed files match %s", strings.Join(monorepoApp.Include, ", "))
+		if len(monorepoApp.Exclude) > 0 {
+			fmt.Fprintf(out, " but not %s", strings.Join(monorepoApp.Exclude, ", "))
+		}
+		fmt.Fprintln(out)
+	}
+	if gate, exists := cfg.Checks[app]; exists {
+		fmt.Fprintf(out, "  Waits for CI: %s\n", strings.Join(gate.Workflows, ", "))
+	}
+
+	rollback, err := deployment.Plan(cfg, req)
+	if err != nil {
+		fmt.Fprintf(out, "  Cannot deploy: %v\n", err)
+		return nil
+	}
+
+	fmt.Fprintln(out, "  Runs:")
+	if cfg.GitCheckout {
+		fmt.Fprintf(out, "    0. checkout: git fetch --force --tags --prune origin && git checkout --force -B %s <pushed commit>\n", branch)
+	}
+	for i, step := range req.Steps {
+		fmt.Fprintf(out, "    %d. %s: %s%s\n", i+1, step.Name, step.Command, stepDetails(step))
+	}
+	if rollback != "" {
+		fmt.Fprintf(out, "  On failure: %s\n", rollback)
+	}
+	return nil
+}
+
+// stepDetails describes the options of a pipeline step, if it has any
+func stepDetails(step deployment.Step) string {
+	var details []string
+	if step.Dir != "" {
+		details = append(details, "in "+step.Dir)
+	}
+	if step.Timeout > 0 {
+		details = append(details, "timeout "+step.Timeout.String())
+	}
+	for _, name := range sortedKeys(step.Env) {
+		details = append(details, name+"="+step.Env[name])
+	}
+	if step.ContinueOnError {
+		details = append(details, "continues on error")
+	}
+	if step.AlwaysRun {
+		details = append(details, "always runs")
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(details, ", ") + "]"
+}
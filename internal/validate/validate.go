@@ -0,0 +1,287 @@
+package validate
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ktappdev/cicd-thing/internal/config"
+	"github.com/ktappdev/cicd-thing/internal/deployment"
+	"github.com/ktappdev/cicd-thing/internal/mapping"
+	"github.com/ktappdev/cicd-thing/internal/security"
+)
+
+// Problem is a configuration mistake found by Check
+type Problem struct {
+	Setting string // where the mistake is, e.g. `commands."web"`
+	Message string
+}
+
+// Run implements "cicd-thing validate [--config path] [--explain repo@branch]".
+// It prints a report to out and returns the process exit code: 0 if the
+// configuration is fine, 1 if it has problems, 2 on bad usage.
+func Run(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(out)
+	configPath := flags.String("config", os.Getenv("CICD_CONFIG"), "config file to check (default: $CICD_CONFIG or the first config.toml found)")
+	explain := flags.String("explain", "", "print what a push to repo@branch would run")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *configPath == "" {
+		path, found := config.Locate()
+		if !found {
+			fmt.Fprintln(out, "No config.toml found; pass one with --config")
+			return 1
+		}
+		*configPath = path
+	}
+	fmt.Fprintf(out, "Checking %s\n\n", *configPath)
+
+	cfg, err := config.LoadFile(*configPath)
+	if err != nil {
+		fmt.Fprintf(out, "✗ %v\n", err)
+		return 1
+	}
+
+	for _, note := range cfg.Notes() {
+		fmt.Fprintf(out, "Note: %s\n", note)
+	}
+
+	problems := Check(cfg)
+	for _, problem := range problems {
+		fmt.Fprintf(out, "✗ %s: %s\n", problem.Setting, problem.Message)
+	}
+	if len(problems) == 0 {
+		fmt.Fprintln(out, "✓ Configuration is valid")
+	} else {
+		fmt.Fprintf(out, "\n%d problem(s) found\n", len(problems))
+	}
+
+	if *explain != "" {
+		fmt.Fprintln(out)
+		if err := Explain(cfg, *explain, out); err != nil {
+			fmt.Fprintf(out, "✗ %v\n", err)
+			return 1
+		}
+	}
+
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Check looks for mistakes that loading the configuration lets through:
+// missing or non-git repository paths, settings for apps no repository
+// deploys, rollbacks without deploy commands, broken pipelines, bad
+// ip_allowlist or trusted_proxies entries, expired API keys, unreadable
+// or expired TLS certificates and non-positive limits
+func Check(cfg *config.Config) []Problem {
+	var problems []Problem
+	add := func(setting, format string, args ...interface{}) {
+		problems = append(problems, Problem{Setting: setting, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if cfg.ConcurrencyLimit <= 0 {
+		add("concurrency_limit", "must be at least 1, got %d", cfg.ConcurrencyLimit)
+	}
+	if cfg.TimeoutSeconds <= 0 {
+		add("timeout_seconds", "must be positive, got %d", cfg.TimeoutSeconds)
+	}
+	if cfg.HistoryRetentionDays < 0 {
+		add("history_retention_days", "must not be negative, got %d", cfg.HistoryRetentionDays)
+	}
+	if cfg.HistoryMaxEntries < 0 {
+		add("history_max_entries", "must not be negative, got %d", cfg.HistoryMaxEntries)
+	}
+	if cfg.HistoryMaxOutputBytes < 0 {
+		add("history_max_output_bytes", "must not be negative, got %d", cfg.HistoryMaxOutputBytes)
+	}
+	if cfg.DeliveryWindow < 0 {
+		add("delivery_window", "must not be negative, got %d", cfg.DeliveryWindow)
+	}
+	if cfg.WebhookMaxAgeMinutes < 0 {
+		add("webhook_max_age_minutes", "must not be negative, got %d", cfg.WebhookMaxAgeMinutes)
+	}
+
+	addressLists := []struct {
+		setting string
+		entries []string
+	}{
+		{"ip_allowlist", cfg.IPAllowlist},
+		{"trusted_proxies", cfg.TrustedProxies},
+	}
+	for _, list := range addressLists {
+		for _, entry := range list.entries {
+			if strings.Contains(entry, "/") {
+				if _, _, err := net.ParseCIDR(entry); err != nil {
+					add(list.setting, "%q is not a valid CIDR block", entry)
+				}
+			} else if net.ParseIP(entry) == nil {
+				add(list.setting, "%q is not a valid IP address", entry)
+			}
+		}
+	}
+
+	mapper := mapping.New(cfg)
+	apps := make(map[string]bool)
+	deployable := make(map[string]bool) // apps with a pipeline that resolves
+	checked := make(map[string]bool)
+	for _, repo := range sortedKeys(cfg.RepoMap) {
+		for _, app := range mapper.GetApps(repo) {
+			apps[app] = true
+
+			setting := fmt.Sprintf("repositories.%q", repo)
+			if _, isMonorepo := cfg.Monorepos[repo]; isMonorepo {
+				setting = fmt.Sprintf("monorepo.%q app %s", repo, app)
+			}
+			path, err := mapper.GetAppPath(repo, app)
+			if err != nil {
+				add(setting, "%v", err)
+			} else if !checked[path] {
+				checked[path] = true
+				if err := checkCheckout(mapper, path); err != nil {
+					add(setting, "%v", err)
+				}
+			}
+
+			pipelineProblems, planned := checkPipelines(cfg, mapper, repo, app)
+			problems = append(problems, pipelineProblems...)
+			if planned {
+				deployable[app] = true
+			}
+		}
+	}
+
+	tables := []struct {
+		name string
+		keys []string
+	}{
+		{"commands", sortedKeys(cfg.Commands)},
+		{"pipelines", sortedKeys(cfg.Pipelines)},
+		{"rollback_commands", sortedKeys(cfg.RollbackCommands)},
+		{"environments", sortedKeys(cfg.Environments)},
+		{"triggers", sortedKeys(cfg.Triggers)},
+		{"previews", sortedKeys(cfg.Previews)},
+		{"checks", sortedKeys(cfg.Checks)},
+		{"generic_hooks", sortedKeys(cfg.GenericHooks)},
+	}
+	for _, table := range tables {
+		for _, app := range table.keys {
+			if !apps[app] {
+				add(fmt.Sprintf("%s.%q", table.name, app), "no repository deploys app %q", app)
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(cfg.APIKeys) {
+		key := cfg.APIKeys[name]
+		setting := fmt.Sprintf("api_keys.%q", name)
+		if !key.Expires.IsZero() && time.Now().After(key.Expires) {
+			add(setting, "expired on %s", key.Expires.Format(time.DateOnly))
+		}
+		problems = append(problems, checkScopes(setting, key.Scopes, apps)...)
+	}
+	for _, name := range sortedKeys(cfg.ClientCerts) {
+		problems = append(problems, checkScopes(fmt.Sprintf("client_certs.%q", name), cfg.ClientCerts[name].Scopes, apps)...)
+	}
+
+	if cfg.TLSCert != "" {
+		tlsConfig, err := security.LoadTLS(cfg)
+		if err != nil {
+			add("tls_cert", "%v", err)
+		} else if leaf := tlsConfig.Certificates[0].Leaf; leaf != nil && time.Now().After(leaf.NotAfter) {
+			add("tls_cert", "certificate expired on %s", leaf.NotAfter.Format(time.DateOnly))
+		}
+	}
+
+	for _, app := range sortedKeys(cfg.RollbackCommands) {
+		if apps[app] && !deployable[app] {
+			add(fmt.Sprintf("rollback_commands.%q", app), "app has a rollback command but no deploy commands: no [commands], [pipelines], environment commands or default_commands apply to it")
+		}
+	}
+
+	return problems
+}
+
+// checkPipelines resolves the pipeline of each environment of an app, or
+// of the app itself if it has none, the way the executor would, and checks
+// environment paths. It also reports whether any pipeline resolved.
+func checkPipelines(cfg *config.Config, mapper *mapping.Mapper, repo, app string) ([]Problem, bool) {
+	var problems []Problem
+	planned := false
+
+	// Apps with environments only ever deploy into one of them
+	if len(cfg.Environments[app]) == 0 {
+		req := &deployment.Request{Repository: repo, App: app}
+		if _, err := deployment.Plan(cfg, req); err != nil {
+			problems = append(problems, Problem{Setting: fmt.Sprintf("app %s", app), Message: err.Error()})
+		} else {
+			planned = true
+		}
+	}
+
+	for _, env := range cfg.Environments[app] {
+		setting := fmt.Sprintf("environments.%s %s", app, env.Name)
+
+		req := &deployment.Request{Repository: repo, App: app, Environment: env.Name}
+		if _, err := deployment.Plan(cfg, req); err != nil {
+			problems = append(problems, Problem{Setting: setting, Message: err.Error()})
+		} else {
+			planned = true
+		}
+
+		if env.Path == "" {
+			continue
+		}
+		path, err := mapper.GetEnvironmentPath(repo, app, &env)
+		if err == nil {
+			err = checkCheckout(mapper, path)
+		}
+		if err != nil {
+			problems = append(problems, Problem{Setting: setting, Message: err.Error()})
+		}
+	}
+	return problems, planned
+}
+
+// checkScopes reports deploy scopes naming apps no repository deploys
+func checkScopes(setting string, scopes []string, apps map[string]bool) []Problem {
+	var problems []Problem
+	for _, scope := range scopes {
+		if app, found := strings.CutPrefix(scope, "deploy:"); found && app != "*" && !apps[app] {
+			problems = append(problems, Problem{Setting: setting, Message: fmt.Sprintf("scope %s names an app no repository deploys", scope)})
+		}
+	}
+	return problems
+}
+
+// checkCheckout reports whether path is an accessible git working tree
+func checkCheckout(mapper *mapping.Mapper, path string) error {
+	if err := mapper.ValidatePath(path); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(path, ".git")); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s is not a git repository", path)
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,236 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// BitbucketCloudPushPayload represents the Bitbucket Cloud repo:push payload
+type BitbucketCloudPushPayload struct {
+	Actor      BitbucketCloudUser `json:"actor"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		Name     string `json:"name"`
+	} `json:"repository"`
+	Push struct {
+		Changes []BitbucketCloudChange `json:"changes"`
+	} `json:"push"`
+}
+
+// BitbucketCloudChange represents a single ref update in a repo:push payload
+type BitbucketCloudChange struct {
+	New     *BitbucketCloudRef     `json:"new"`
+	Old     *BitbucketCloudRef     `json:"old"`
+	Created bool                   `json:"created"`
+	Closed  bool                   `json:"closed"`
+	Commits []BitbucketCloudCommit `json:"commits"`
+}
+
+// BitbucketCloudRef represents a branch or tag in a repo:push payload
+type BitbucketCloudRef struct {
+	Type   string               `json:"type"` // "branch" or "tag"
+	Name   string               `json:"name"`
+	Target BitbucketCloudCommit `json:"target"`
+}
+
+// BitbucketCloudCommit represents a commit in a repo:push payload
+type BitbucketCloudCommit struct {
+	Hash    string    `json:"hash"`
+	Message string    `json:"message"`
+	Date    time.Time `json:"date"`
+	Author  struct {
+		Raw  string              `json:"raw"` // "Name <email>"
+		User *BitbucketCloudUser `json:"user"`
+	} `json:"author"`
+}
+
+// BitbucketCloudUser represents a Bitbucket Cloud account
+type BitbucketCloudUser struct {
+	DisplayName string `json:"display_name"`
+	Nickname    string `json:"nickname"`
+}
+
+// BitbucketServerPayload represents the Bitbucket Server / Data Center
+// repo:refs_changed payload
+type BitbucketServerPayload struct {
+	EventKey string `json:"eventKey"`
+	Date     string `json:"date"`
+	Actor    struct {
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"actor"`
+	Repository struct {
+		Slug    string `json:"slug"`
+		Name    string `json:"name"`
+		Project struct {
+			Key  string `json:"key"`
+			Name string `json:"name"`
+		} `json:"project"`
+	} `json:"repository"`
+	Changes []BitbucketServerChange `json:"changes"`
+}
+
+// BitbucketServerChange represents a single ref update in repo:refs_changed
+type BitbucketServerChange struct {
+	Ref struct {
+		ID        string `json:"id"` // e.g. "refs/heads/main"
+		DisplayID string `json:"displayId"`
+		Type      string `json:"type"` // "BRANCH" or "TAG"
+	} `json:"ref"`
+	RefID    string `json:"refId"`
+	FromHash string `json:"fromHash"`
+	ToHash   string `json:"toHash"`
+	Type     string `json:"type"` // "ADD", "UPDATE" or "DELETE"
+}
+
+// bitbucketProvider handles Bitbucket Cloud (repo:push) and Bitbucket
+// Server / Data Center (repo:refs_changed) webhooks. Both sign the body
+// with an HMAC-SHA256 in X-Hub-Signature as "sha256=<hex>".
+type bitbucketProvider struct {
+	secret string
+}
+
+// Name implements Provider
+func (p *bitbucketProvider) Name() string {
+	return "bitbucket"
+}
+
+// Matches implements Provider
+func (p *bitbucketProvider) Matches(r *http.Request) bool {
+	return r.Header.Get("X-Event-Key") != ""
+}
+
+// DeliveryID returns the X-Request-UUID of Bitbucket Cloud, or the
+// X-Request-Id of Bitbucket Data Center
+func (p *bitbucketProvider) DeliveryID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-UUID"); id != "" {
+		return id
+	}
+	return r.Header.Get("X-Request-Id")
+}
+
+// Verify checks the X-Hub-Signature HMAC of the body
+func (p *bitbucketProvider) Verify(r *http.Request, body []byte) bool {
+	signature, found := strings.CutPrefix(r.Header.Get("X-Hub-Signature"), "sha256=")
+	if !found {
+		return false
+	}
+	return validHMAC(p.secret, signature, body)
+}
+
+// Parse handles repo:push and repo:refs_changed; each changed ref becomes
+// its own push event
+func (p *bitbucketProvider) Parse(r *http.Request, body []byte) ([]*PushEvent, error) {
+	switch r.Header.Get("X-Event-Key") {
+	case "repo:push":
+		return p.parseCloud(body)
+	case "repo:refs_changed":
+		return p.parseServer(body)
+	default:
+		return nil, nil
+	}
+}
+
+// parseCloud normalizes a Bitbucket Cloud repo:push payload
+func (p *bitbucketProvider) parseCloud(body []byte) ([]*PushEvent, error) {
+	var payload BitbucketCloudPushPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse Bitbucket payload: %w", err)
+	}
+
+	events := []*PushEvent{}
+	for _, change := range payload.Push.Changes {
+		ref := change.New
+		if ref == nil {
+			ref = change.Old // deleted ref; keep the name so it can be skipped
+		}
+		if ref == nil {
+			continue
+		}
+
+		event := &PushEvent{
+			Provider:   p.Name(),
+			Repository: payload.Repository.FullName,
+			Ref:        bitbucketRef(ref.Type, ref.Name),
+			Author:     payload.Actor.DisplayName,
+			Deleted:    change.New == nil || change.Closed,
+		}
+
+		if change.New != nil {
+			head := change.New.Target
+			event.Commit = head.Hash
+			event.Message = head.Message
+			event.Timestamp = head.Date
+			if head.Author.User != nil && head.Author.User.DisplayName != "" {
+				event.Author = head.Author.User.DisplayName
+			}
+		}
+
+		for _, c := range change.Commits {
+			event.Commits = append(event.Commits, Commit{
+				ID:        c.Hash,
+				Message:   c.Message,
+				Timestamp: c.Date,
+				Author:    Author{Name: bitbucketAuthorName(c.Author.Raw)},
+			})
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// parseServer normalizes a Bitbucket Server repo:refs_changed payload
+func (p *bitbucketProvider) parseServer(body []byte) ([]*PushEvent, error) {
+	var payload BitbucketServerPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse Bitbucket payload: %w", err)
+	}
+
+	repository := payload.Repository.Project.Key + "/" + payload.Repository.Slug
+	author := payload.Actor.DisplayName
+	if author == "" {
+		author = payload.Actor.Name
+	}
+	timestamp, _ := time.Parse("2006-01-02T15:04:05-0700", payload.Date)
+
+	events := []*PushEvent{}
+	for _, change := range payload.Changes {
+		ref := change.Ref.ID
+		if ref == "" {
+			ref = change.RefID
+		}
+
+		events = append(events, &PushEvent{
+			Provider:   p.Name(),
+			Repository: repository,
+			Ref:        ref,
+			Commit:     change.ToHash,
+			Author:     author,
+			Timestamp:  timestamp,
+			Deleted:    change.Type == "DELETE" || isZeroCommit(change.ToHash),
+		})
+	}
+
+	return events, nil
+}
+
+// bitbucketRef builds a full ref name from a Bitbucket Cloud ref type and name
+func bitbucketRef(refType, name string) string {
+	if refType == "tag" {
+		return "refs/tags/" + name
+	}
+	return "refs/heads/" + name
+}
+
+// bitbucketAuthorName extracts the name from a raw "Name <email>" author
+func bitbucketAuthorName(raw string) string {
+	if i := strings.Index(raw, " <"); i >= 0 {
+		return raw[:i]
+	}
+	return raw
+}
@@ -0,0 +1,269 @@
+package webhook
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DeliveryLog remembers the keys of recent webhook deliveries so a retried
+// or replayed delivery is processed only once. Keys are appended to a JSON
+// lines file so the window survives restarts; the file is compacted once
+// it holds twice as many lines as the window.
+type DeliveryLog struct {
+	path  string
+	limit int
+	mutex sync.Mutex
+	file  *os.File
+	order []string // oldest first
+	seen  map[string]time.Time
+	lines int
+}
+
+// deliveryRecord is one line of the delivery file
+type deliveryRecord struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	Released bool      `json:"released,omitempty"`
+}
+
+// OpenDeliveryLog opens (or creates) the delivery file at path, keeping
+// the last limit delivery IDs
+func OpenDeliveryLog(path string, limit int) (*DeliveryLog, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create delivery directory %s: %w", dir, err)
+		}
+	}
+
+	d := &DeliveryLog{
+		path:  path,
+		limit: limit,
+		seen:  make(map[string]time.Time),
+	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	if err := d.rewrite(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Claim records a delivery ID. It returns false if the ID was already
+// recorded, i.e. the delivery is a retry or a replay.
+func (d *DeliveryLog) Claim(id string) (bool, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, exists := d.seen[id]; exists {
+		return false, nil
+	}
+	record := deliveryRecord{ID: id, Time: time.Now()}
+	d.add(record)
+	return true, d.write(record)
+}
+
+// Release forgets a claimed delivery that couldn't be processed, so the
+// forge's retry is accepted
+func (d *DeliveryLog) Release(id string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	record := deliveryRecord{ID: id, Time: time.Now(), Released: true}
+	d.add(record)
+	return d.write(record)
+}
+
+// Close closes the underlying delivery file
+func (d *DeliveryLog) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.file != nil {
+		return d.file.Close()
+	}
+	return nil
+}
+
+// load reads the delivery file, replaying claims and releases in order
+func (d *DeliveryLog) load() error {
+	file, err := os.Open(d.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open delivery file %s: %w", d.path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record deliveryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// Skip corrupt lines (e.g. a partial write before a crash)
+			continue
+		}
+		d.add(record)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read delivery file %s: %w", d.path, err)
+	}
+	return nil
+}
+
+// add applies a claim or release to the window, dropping the oldest IDs
+// beyond the limit (caller must hold the lock)
+func (d *DeliveryLog) add(record deliveryRecord) {
+	if record.Released {
+		if _, exists := d.seen[record.ID]; exists {
+			delete(d.seen, record.ID)
+			d.order = slices.DeleteFunc(d.order, func(id string) bool { return id == record.ID })
+		}
+		return
+	}
+
+	if _, exists := d.seen[record.ID]; !exists {
+		d.order = append(d.order, record.ID)
+	}
+	d.seen[record.ID] = record.Time
+	for len(d.order) > d.limit {
+		delete(d.seen, d.order[0])
+		d.order = d.order[1:]
+	}
+}
+
+// write appends a record to the file, compacting it when it has grown
+// too long (caller must hold the lock)
+func (d *DeliveryLog) write(record deliveryRecord) error {
+	if d.lines >= 2*d.limit {
+		return d.rewrite()
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal delivery record: %w", err)
+	}
+	if _, err := d.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write delivery record: %w", err)
+	}
+	d.lines++
+	return nil
+}
+
+// rewrite replaces the delivery file with the IDs in the window (caller
+// must hold the lock)
+func (d *DeliveryLog) rewrite() error {
+	tmpPath := d.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create delivery file %s: %w", tmpPath, err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	for _, id := range d.order {
+		data, err := json.Marshal(deliveryRecord{ID: id, Time: d.seen[id]})
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to marshal delivery record: %w", err)
+		}
+		writer.Write(data)
+		writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write delivery file %s: %w", tmpPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write delivery file %s: %w", tmpPath, err)
+	}
+
+	if d.file != nil {
+		d.file.Close()
+		d.file = nil
+	}
+	if err := os.Rename(tmpPath, d.path); err != nil {
+		return fmt.Errorf("failed to replace delivery file %s: %w", d.path, err)
+	}
+
+	file, err := os.OpenFile(d.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open delivery file %s: %w", d.path, err)
+	}
+	d.file = file
+	d.lines = len(d.order)
+	return nil
+}
+
+// delivery identifies a webhook delivery for deduplication
+type delivery struct {
+	source string // provider name, or "generic:<app>"
+	id     string // what the sender calls the delivery, for logs
+	key    string // what is deduplicated on; "" for no deduplication
+}
+
+// forgeDelivery identifies a forge delivery by its delivery ID or, when
+// the forge (or a proxy in between) sent none, by the SHA-256 of its
+// signed body, which a retry repeats exactly
+func forgeDelivery(source, id string, body []byte) delivery {
+	if id != "" {
+		return idDelivery(source, id)
+	}
+	sum := sha256.Sum256(body)
+	return delivery{source: source, key: source + ":sha256:" + hex.EncodeToString(sum[:])}
+}
+
+// idDelivery identifies a delivery by an ID taken from its authenticated
+// body
+func idDelivery(source, id string) delivery {
+	d := delivery{source: source, id: id}
+	if id != "" {
+		d.key = source + ":" + id
+	}
+	return d
+}
+
+// String names the delivery in log messages
+func (d delivery) String() string {
+	if d.id == "" {
+		return d.source + " delivery without ID"
+	}
+	return d.source + " delivery " + d.id
+}
+
+// claimDelivery records an authenticated delivery and reports whether it
+// is new
+func (h *Handler) claimDelivery(d delivery) bool {
+	if h.deliveries == nil || d.key == "" {
+		return true
+	}
+
+	fresh, err := h.deliveries.Claim(d.key)
+	if err != nil {
+		h.logf("Failed to record %s: %v", d, err)
+	}
+	if !fresh {
+		h.logf("%s already processed, ignoring it", d)
+		return false
+	}
+	h.logf("%s accepted", d)
+	return true
+}
+
+// releaseDelivery forgets a delivery that failed, so that a retry of it is
+// processed
+func (h *Handler) releaseDelivery(d delivery) {
+	if h.deliveries == nil || d.key == "" {
+		return
+	}
+	if err := h.deliveries.Release(d.key); err != nil {
+		h.logf("Failed to record %s: %v", d, err)
+	}
+	h.logf("%s failed, a retry will be processed", d)
+}
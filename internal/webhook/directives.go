@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// directivePattern finds bracketed directives such as "[skip deploy]" or
+// "[deploy: api-service]" in a commit message
+var directivePattern = regexp.MustCompile(`\[([^\[\]]+)\]`)
+
+// directives are the deployment instructions found in a commit message
+type directives struct {
+	found      []string // the directives as written, e.g. "[no-rollback]"
+	skip       string   // [skip deploy], [deploy skip], [ci skip] or [skip ci]
+	apps       []string // [deploy: a, b] restricts deployment to these apps
+	noRollback bool     // [no-rollback] disables auto-rollback
+}
+
+// parseDirectives extracts deployment directives from a commit message.
+// Matching is case-insensitive and unknown bracketed text is ignored.
+func parseDirectives(message string) directives {
+	var d directives
+	for _, match := range directivePattern.FindAllStringSubmatch(message, -1) {
+		text := strings.ToLower(strings.Join(strings.Fields(match[1]), " "))
+
+		switch text {
+		case "skip deploy", "deploy skip", "ci skip", "skip ci":
+			d.skip = match[0]
+		case "no-rollback", "no rollback":
+			d.noRollback = true
+		default:
+			apps, ok := strings.CutPrefix(text, "deploy:")
+			if !ok {
+				continue
+			}
+			for _, app := range strings.Split(apps, ",") {
+				if app = strings.TrimSpace(app); app != "" {
+					d.apps = append(d.apps, app)
+				}
+			}
+		}
+		d.found = append(d.found, match[0])
+	}
+	return d
+}
+
+// applyDirectives applies the commit message directives to a deployment
+// request for one app. An app left out of a [deploy: ...] list or a skip
+// directive keeps the request but marks it skipped so the reason ends up
+// in the history. Teardowns ignore directives, a closed pull request is
+// always cleaned up.
+func (h *Handler) applyDirectives(deploymentReq *DeploymentRequest) {
+	if deploymentReq.Teardown {
+		return
+	}
+
+	d := parseDirectives(deploymentReq.Message)
+	if len(d.found) == 0 {
+		return
+	}
+
+	app := deploymentReq.App
+	h.logf("%s: commit %s directives for %s: %s", deploymentReq.Repository, shortSHA(deploymentReq.Commit), app, strings.Join(d.found, " "))
+
+	deploymentReq.Directives = d.found
+	deploymentReq.NoRollback = d.noRollback
+	switch {
+	case len(d.apps) > 0 && !slices.ContainsFunc(d.apps, func(name string) bool { return strings.EqualFold(name, app) }):
+		deploymentReq.SkipReason = "Skipped, not listed in the commit's deploy directive"
+		h.logf("%s: skipping %s, not listed in the commit's deploy directive", deploymentReq.Repository, app)
+	case d.skip != "":
+		deploymentReq.SkipReason = fmt.Sprintf("Skipped by %s in commit message", d.skip)
+		h.logf("%s: skipping %s, commit message asks not to deploy", deploymentReq.Repository, app)
+	}
+}
+
+// shortSHA abbreviates a commit hash for log messages
+func shortSHA(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
@@ -0,0 +1,253 @@
+package webhook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ktappdev/cicd-thing/internal/audit"
+)
+
+// maxGenericBodySize caps the size of generic webhook bodies
+const maxGenericBodySize = 1 << 20
+
+// GenericPayload is the body accepted by /hooks/generic/{app}
+type GenericPayload struct {
+	Repository string            `json:"repository"` // optional, defaults to the app's mapped repository
+	Ref        string            `json:"ref"`        // branch name or full ref, defaults to the branch filter
+	SHA        string            `json:"sha"`        // commit to deploy, defaults to the branch tip
+	Message    string            `json:"message"`
+	Author     string            `json:"author"`
+	Metadata   map[string]string `json:"metadata"`
+	DeliveryID string            `json:"delivery_id"` // required for signed requests; a repeated ID is not deployed again
+}
+
+// HandleGeneric triggers a deployment of {app} from any CI system. The
+// request is authenticated with the app's generic hook secret or token.
+// With ?wait=true the response is held until the deployment finishes. A
+// delivery_id in the payload makes retries of the same request deploy only
+// once; signed requests must carry one, as anyone who captured one could
+// otherwise replay it.
+func (h *Handler) HandleGeneric(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	appName := r.PathValue("app")
+	hook, exists := h.config.Load().GenericHooks[appName]
+	if !exists {
+		http.Error(w, "Generic webhook not configured for this app", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxGenericBodySize))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	valid, signed := verifyGeneric(r, body, hook.Secret, hook.Token)
+	if !valid {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var payload GenericPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "Failed to parse webhook payload", http.StatusBadRequest)
+		return
+	}
+
+	// The delivery ID is part of the authenticated body, so it can't be
+	// changed to replay a request
+	if signed && payload.DeliveryID == "" && h.deliveries != nil {
+		h.logf("Rejected signed generic delivery for %s without a delivery_id", appName)
+		http.Error(w, "Missing delivery_id", http.StatusBadRequest)
+		return
+	}
+	delivery := idDelivery("generic:"+appName, payload.DeliveryID)
+	if payload.DeliveryID != "" && !h.claimDelivery(delivery) {
+		writeGenericResponse(w, map[string]interface{}{
+			"status":  "duplicate",
+			"message": "Delivery already processed",
+		})
+		return
+	}
+
+	event, err := h.genericPushEvent(appName, &payload)
+	if err != nil {
+		h.releaseDelivery(delivery)
+		http.Error(w, fmt.Sprintf("Failed to process webhook: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	deploymentReq, err := h.processWebhook(event, appName)
+	if err != nil {
+		h.releaseDelivery(delivery)
+		http.Error(w, fmt.Sprintf("Failed to process webhook: %v", err), http.StatusBadRequest)
+		return
+	}
+	if deploymentReq == nil {
+		writeGenericResponse(w, map[string]interface{}{
+			"status":  "skipped",
+			"message": "No deployment triggered",
+		})
+		return
+	}
+
+	req := deploymentReq.toRequest()
+	req.Metadata = payload.Metadata
+
+	if deploymentReq.SkipReason != "" {
+		h.executor.Skip(req, deploymentReq.SkipReason)
+		writeGenericResponse(w, map[string]interface{}{
+			"status":  "skipped",
+			"message": deploymentReq.SkipReason,
+			"id":      req.ID,
+		})
+		return
+	}
+
+	// [checks.<app>] gates forge pushes only: the generic hook is sent by a
+	// CI system, usually once its own build passed, and the workflow_run
+	// or check_suite events a held deployment waits for may never come
+	if _, gated := h.config.Load().Checks[appName]; gated {
+		h.logf("%s: generic hook for %s deploys without waiting for checks", deploymentReq.Repository, appName)
+	}
+
+	credential := "generic hook token"
+	if signed {
+		credential = "generic hook signature"
+	}
+	audited := h.deployEntry(credential, deploymentReq)
+
+	if r.URL.Query().Get("wait") != "true" {
+		if err := h.executor.Deploy(req); err != nil {
+			audited.Outcome, audited.Detail = audit.OutcomeFailure, audited.Detail+": "+err.Error()
+			h.audit(r, audited)
+			h.releaseDelivery(delivery)
+			http.Error(w, fmt.Sprintf("Failed to trigger deployment: %v", err), http.StatusInternalServerError)
+			return
+		}
+		audited.Outcome, audited.RequestID = audit.OutcomeSuccess, req.ID
+		h.audit(r, audited)
+		writeGenericResponse(w, map[string]interface{}{
+			"status":  "queued",
+			"message": "Deployment triggered successfully",
+			"id":      req.ID,
+		})
+		return
+	}
+
+	result, err := h.executor.DeployAndWait(r.Context(), req)
+
+	// A client that stopped waiting leaves the deployment running
+	audited.Outcome, audited.RequestID = audit.OutcomeSuccess, req.ID
+	if err != nil && r.Context().Err() == nil {
+		audited.Outcome, audited.RequestID, audited.Detail = audit.OutcomeFailure, "", audited.Detail+": "+err.Error()
+	}
+	h.audit(r, audited)
+
+	if err != nil {
+		if r.Context().Err() == nil {
+			h.releaseDelivery(delivery)
+		}
+		http.Error(w, fmt.Sprintf("Failed to complete deployment: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"status":   result.Status,
+		"id":       req.ID,
+		"duration": result.Duration.Seconds(),
+	}
+	if result.ResolvedCommit != "" {
+		response["commit"] = result.ResolvedCommit
+	}
+	if result.Error != "" {
+		response["error"] = result.Error
+	}
+	if result.SupersededBy != "" {
+		response["superseded_by"] = result.SupersededBy
+	}
+	writeGenericResponse(w, response)
+}
+
+// genericPushEvent turns a generic payload into a push event for appName
+func (h *Handler) genericPushEvent(appName string, payload *GenericPayload) (*PushEvent, error) {
+	repository := payload.Repository
+	if repository == "" {
+		repo, exists := h.mapper.GetRepository(appName)
+		if !exists {
+			return nil, fmt.Errorf("no repository mapped to app %s", appName)
+		}
+		repository = repo
+	} else if !slices.Contains(h.mapper.GetApps(repository), appName) {
+		return nil, fmt.Errorf("repository %s does not belong to app %s", repository, appName)
+	}
+
+	ref := payload.Ref
+	if ref == "" {
+		ref = h.config.Load().BranchFilter
+		if ref == "" {
+			ref = "main"
+		}
+	}
+	if !strings.HasPrefix(ref, "refs/") {
+		ref = "refs/heads/" + ref
+	}
+
+	author := payload.Author
+	if author == "" {
+		author = "generic webhook"
+	}
+
+	return &PushEvent{
+		Provider:   "generic",
+		Repository: repository,
+		Ref:        ref,
+		Commit:     payload.SHA,
+		Message:    payload.Message,
+		Author:     author,
+		Timestamp:  time.Now(),
+	}, nil
+}
+
+// verifyGeneric accepts a request carrying a valid X-Signature-256 HMAC or
+// the configured bearer token, and reports whether it was the signature
+func verifyGeneric(r *http.Request, body []byte, secret, token string) (valid, signed bool) {
+	if secret != "" {
+		if signature, found := strings.CutPrefix(r.Header.Get("X-Signature-256"), "sha256="); found && validHMAC(secret, signature, body) {
+			return true, true
+		}
+	}
+
+	if token != "" {
+		provided, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if found && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+			return true, false
+		}
+	}
+
+	return false, false
+}
+
+// writeGenericResponse writes a JSON response with status 200
+func writeGenericResponse(w http.ResponseWriter, response map[string]interface{}) {
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Failed to generate response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
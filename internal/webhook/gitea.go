@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// giteaProvider handles Gitea and Forgejo webhooks. Their push payload is
+// GitHub-compatible, but the signature is a bare hex HMAC-SHA256 without
+// the "sha256=" prefix. Gitea also sends X-GitHub-Event for compatibility,
+// so this provider must be matched before the GitHub one.
+type giteaProvider struct {
+	secret string
+}
+
+// Name implements Provider
+func (p *giteaProvider) Name() string {
+	return "gitea"
+}
+
+// Matches implements Provider
+func (p *giteaProvider) Matches(r *http.Request) bool {
+	return giteaHeader(r, "Event") != ""
+}
+
+// DeliveryID returns the X-Gitea-Delivery (or X-Forgejo-Delivery) GUID
+func (p *giteaProvider) DeliveryID(r *http.Request) string {
+	return giteaHeader(r, "Delivery")
+}
+
+// Verify checks the X-Gitea-Signature (or X-Forgejo-Signature) HMAC of the body
+func (p *giteaProvider) Verify(r *http.Request, body []byte) bool {
+	return validHMAC(p.secret, giteaHeader(r, "Signature"), body)
+}
+
+// Parse handles push events
+func (p *giteaProvider) Parse(r *http.Request, body []byte) ([]*PushEvent, error) {
+	if giteaHeader(r, "Event") != "push" {
+		return nil, nil
+	}
+
+	var payload GitHubWebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse Gitea payload: %w", err)
+	}
+
+	// Older Gitea releases omit head_commit; the last commit is the head
+	if payload.HeadCommit.ID == "" && len(payload.Commits) > 0 {
+		last := payload.Commits[len(payload.Commits)-1]
+		payload.HeadCommit = HeadCommit(last)
+	}
+
+	event := pushEventFromGitHub(&payload)
+	event.Provider = p.Name()
+	return []*PushEvent{event}, nil
+}
+
+// giteaHeader reads an X-Forgejo-* header, falling back to X-Gitea-*
+func giteaHeader(r *http.Request, name string) string {
+	if value := r.Header.Get("X-Forgejo-" + name); value != "" {
+		return value
+	}
+	return r.Header.Get("X-Gitea-" + name)
+}
@@ -0,0 +1,200 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ktappdev/cicd-thing/internal/config"
+)
+
+// giteaTestSecret signed the .sig fixtures in testdata
+const giteaTestSecret = "gitea-test-secret"
+
+// readFixture returns the contents of a file in testdata
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+	return data
+}
+
+// giteaRequest builds a delivery with the given headers
+func giteaRequest(headers map[string]string) *http.Request {
+	r := httptest.NewRequest("POST", "/webhook", nil)
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+	return r
+}
+
+func TestGiteaMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		matches bool
+	}{
+		{"gitea", map[string]string{"X-Gitea-Event": "push", "X-GitHub-Event": "push"}, true},
+		{"forgejo", map[string]string{"X-Forgejo-Event": "push", "X-Gitea-Event": "push"}, true},
+		{"github", map[string]string{"X-GitHub-Event": "push"}, false},
+		{"gitlab", map[string]string{"X-Gitlab-Event": "Push Hook"}, false},
+		{"no headers", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := &giteaProvider{secret: giteaTestSecret}
+			if matches := provider.Matches(giteaRequest(test.headers)); matches != test.matches {
+				t.Errorf("Matches = %v, want %v", matches, test.matches)
+			}
+		})
+	}
+
+	// Gitea also sends X-GitHub-Event, so detection must not fall through
+	// to the GitHub provider
+	h := New(&config.Config{WebhookSecret: "github-secret", GiteaSecret: giteaTestSecret}, nil, nil, nil, nil)
+	r := giteaRequest(map[string]string{"X-Gitea-Event": "push", "X-GitHub-Event": "push"})
+	if name := h.detectProvider(r).Name(); name != "gitea" {
+		t.Errorf("detectProvider = %s, want gitea", name)
+	}
+}
+
+func TestGiteaVerify(t *testing.T) {
+	push := readFixture(t, "gitea_push.json")
+	pushSignature := string(readFixture(t, "gitea_push.sig"))
+	tag := readFixture(t, "gitea_tag_push.json")
+	tagSignature := string(readFixture(t, "gitea_tag_push.sig"))
+
+	tests := []struct {
+		name    string
+		secret  string
+		headers map[string]string
+		body    []byte
+		valid   bool
+	}{
+		{"signed push", giteaTestSecret, map[string]string{"X-Gitea-Signature": pushSignature}, push, true},
+		{"signed tag push", giteaTestSecret, map[string]string{"X-Gitea-Signature": tagSignature}, tag, true},
+		{"forgejo signature", giteaTestSecret, map[string]string{"X-Forgejo-Signature": pushSignature}, push, true},
+		{"unsigned push", giteaTestSecret, nil, push, false},
+		{"unsigned tag push", giteaTestSecret, nil, tag, false},
+		{"signature of another body", giteaTestSecret, map[string]string{"X-Gitea-Signature": tagSignature}, push, false},
+		{"wrong secret", "other-secret", map[string]string{"X-Gitea-Signature": pushSignature}, push, false},
+		{"no secret configured", "", map[string]string{"X-Gitea-Signature": pushSignature}, push, false},
+		{"github style prefix", giteaTestSecret, map[string]string{"X-Gitea-Signature": "sha256=" + pushSignature}, push, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := &giteaProvider{secret: test.secret}
+			if valid := provider.Verify(giteaRequest(test.headers), test.body); valid != test.valid {
+				t.Errorf("Verify = %v, want %v", valid, test.valid)
+			}
+		})
+	}
+}
+
+func TestGiteaParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   string
+		fixture string
+		want    *PushEvent // nil when the event is not deployed on
+		files   []string
+	}{
+		{
+			name:    "push",
+			event:   "push",
+			fixture: "gitea_push.json",
+			want: &PushEvent{
+				Provider:   "gitea",
+				Repository: "acme/api",
+				Ref:        "refs/heads/main",
+				Commit:     "9f3e2d1c0b4a59687d6e5f4a3b2c1d0e9f8a7b6c",
+				Message:    "Add health endpoint\n",
+				Author:     "Jane Doe",
+				Timestamp:  time.Date(2024, 5, 14, 8, 21, 33, 0, time.UTC),
+			},
+			files: []string{"handlers/health.go", "main.go"},
+		},
+		{
+			name:    "tag push",
+			event:   "push",
+			fixture: "gitea_tag_push.json",
+			want: &PushEvent{
+				Provider:   "gitea",
+				Repository: "acme/api",
+				Ref:        "refs/tags/v1.4.0",
+				Commit:     "9f3e2d1c0b4a59687d6e5f4a3b2c1d0e9f8a7b6c",
+				Message:    "Add health endpoint\n",
+				Author:     "Jane Doe",
+				Timestamp:  time.Date(2024, 5, 14, 8, 21, 33, 0, time.UTC),
+			},
+		},
+		{
+			name:    "push without head_commit",
+			event:   "push",
+			fixture: "gitea_push_legacy.json",
+			want: &PushEvent{
+				Provider:   "gitea",
+				Repository: "acme/api",
+				Ref:        "refs/heads/main",
+				Commit:     "9f3e2d1c0b4a59687d6e5f4a3b2c1d0e9f8a7b6c",
+				Message:    "Add health endpoint\n",
+				Author:     "Jane Doe",
+				Timestamp:  time.Date(2024, 5, 14, 8, 21, 33, 0, time.UTC),
+			},
+			files: []string{"go.mod", "go.sum", "handlers/health.go", "main.go"},
+		},
+		{
+			name:    "other event",
+			event:   "issues",
+			fixture: "gitea_push.json",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := &giteaProvider{secret: giteaTestSecret}
+			r := giteaRequest(map[string]string{"X-Gitea-Event": test.event})
+			events, err := provider.Parse(r, readFixture(t, test.fixture))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if test.want == nil {
+				if events != nil {
+					t.Fatalf("Parse returned %d events, want none", len(events))
+				}
+				return
+			}
+			if len(events) != 1 {
+				t.Fatalf("Parse returned %d events, want 1", len(events))
+			}
+
+			got := events[0]
+			if got.Provider != test.want.Provider || got.Repository != test.want.Repository ||
+				got.Ref != test.want.Ref || got.Commit != test.want.Commit ||
+				got.Message != test.want.Message || got.Author != test.want.Author ||
+				got.Deleted {
+				t.Errorf("Parse = %+v, want %+v", got, test.want)
+			}
+			if !got.Timestamp.Equal(test.want.Timestamp) {
+				t.Errorf("Timestamp = %v, want %v", got.Timestamp, test.want.Timestamp)
+			}
+			if files := strings.Join(changedFiles(got.Commits), ","); files != strings.Join(test.files, ",") {
+				t.Errorf("changed files = %s, want %s", files, strings.Join(test.files, ","))
+			}
+		})
+	}
+
+	provider := &giteaProvider{secret: giteaTestSecret}
+	r := giteaRequest(map[string]string{"X-Gitea-Event": "push"})
+	if _, err := provider.Parse(r, []byte(`{"ref": `)); err == nil {
+		t.Error("Parse of a truncated payload succeeded, want an error")
+	}
+}
@@ -0,0 +1,169 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// githubProvider handles GitHub webhooks signed with X-Hub-Signature-256
+type githubProvider struct {
+	secret string
+}
+
+// Name implements Provider
+func (p *githubProvider) Name() string {
+	return "github"
+}
+
+// Matches implements Provider
+func (p *githubProvider) Matches(r *http.Request) bool {
+	return r.Header.Get("X-GitHub-Event") != ""
+}
+
+// DeliveryID returns the X-GitHub-Delivery GUID
+func (p *githubProvider) DeliveryID(r *http.Request) string {
+	return r.Header.Get("X-GitHub-Delivery")
+}
+
+// Verify checks the X-Hub-Signature-256 HMAC of the body
+func (p *githubProvider) Verify(r *http.Request, body []byte) bool {
+	// Remove the "sha256=" prefix
+	signature, found := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	if !found {
+		return false
+	}
+	return validHMAC(p.secret, signature, body)
+}
+
+// Parse handles push, release and pull_request events
+func (p *githubProvider) Parse(r *http.Request, body []byte) ([]*PushEvent, error) {
+	switch r.Header.Get("X-GitHub-Event") {
+	case "push":
+	case "release":
+		return p.parseRelease(body)
+	case "pull_request":
+		return p.parsePullRequest(body)
+	default:
+		return nil, nil
+	}
+
+	var payload GitHubWebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub payload: %w", err)
+	}
+
+	return []*PushEvent{pushEventFromGitHub(&payload)}, nil
+}
+
+// ParseCheck handles completed workflow_run and check_suite events
+func (p *githubProvider) ParseCheck(r *http.Request, body []byte) (*CheckEvent, error) {
+	switch r.Header.Get("X-GitHub-Event") {
+	case "workflow_run":
+		var payload GitHubWorkflowRunPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("failed to parse GitHub payload: %w", err)
+		}
+		if payload.Action != "completed" {
+			return nil, nil
+		}
+		return &CheckEvent{
+			Repository: payload.Repository.FullName,
+			Commit:     payload.WorkflowRun.HeadSHA,
+			Name:       payload.WorkflowRun.Name,
+			Conclusion: payload.WorkflowRun.Conclusion,
+		}, nil
+	case "check_suite":
+		var payload GitHubCheckSuitePayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("failed to parse GitHub payload: %w", err)
+		}
+		if payload.Action != "completed" {
+			return nil, nil
+		}
+		return &CheckEvent{
+			Repository: payload.Repository.FullName,
+			Commit:     payload.CheckSuite.HeadSHA,
+			Name:       payload.CheckSuite.App.Name,
+			Conclusion: payload.CheckSuite.Conclusion,
+		}, nil
+	}
+	return nil, nil
+}
+
+// parseRelease turns a published release into a tag event
+func (p *githubProvider) parseRelease(body []byte) ([]*PushEvent, error) {
+	var payload GitHubReleasePayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub payload: %w", err)
+	}
+
+	// Only published releases deploy; drafts, edits and deletions don't
+	if payload.Action != "published" || payload.Release.Draft {
+		return []*PushEvent{}, nil
+	}
+
+	message := payload.Release.Name
+	if message == "" {
+		message = "Release " + payload.Release.TagName
+	}
+
+	return []*PushEvent{{
+		Provider:   p.Name(),
+		Repository: payload.Repository.FullName,
+		Ref:        "refs/tags/" + payload.Release.TagName,
+		Commit:     payload.Release.TagName, // resolved to a SHA at checkout
+		Message:    message,
+		Author:     payload.Release.Author.Login,
+		Timestamp:  payload.Release.PublishedAt,
+		Release:    true,
+	}}, nil
+}
+
+// parsePullRequest turns pull request activity into a preview event
+func (p *githubProvider) parsePullRequest(body []byte) ([]*PushEvent, error) {
+	var payload GitHubPullRequestPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub payload: %w", err)
+	}
+
+	switch payload.Action {
+	case "opened", "reopened", "synchronize", "closed":
+	default:
+		// Labels, reviews, edits and the like don't change the code
+		return []*PushEvent{}, nil
+	}
+
+	pr := payload.PullRequest
+	event := &PushEvent{
+		Provider:    p.Name(),
+		Repository:  payload.Repository.FullName,
+		Ref:         "refs/heads/" + pr.Head.Ref,
+		Commit:      pr.Head.SHA,
+		Message:     pr.Title,
+		Author:      pr.User.Login,
+		Timestamp:   pr.UpdatedAt,
+		PullRequest: payload.Number,
+		Closed:      payload.Action == "closed",
+	}
+	if pr.Head.Repo != nil {
+		event.HeadRepository = pr.Head.Repo.FullName
+	}
+	return []*PushEvent{event}, nil
+}
+
+// pushEventFromGitHub normalizes a GitHub push payload
+func pushEventFromGitHub(payload *GitHubWebhookPayload) *PushEvent {
+	return &PushEvent{
+		Provider:   "github",
+		Repository: payload.Repository.FullName,
+		Ref:        payload.Ref,
+		Commit:     payload.After,
+		Message:    payload.HeadCommit.Message,
+		Author:     payload.HeadCommit.Author.Name,
+		Timestamp:  payload.HeadCommit.Timestamp,
+		Commits:    payload.Commits,
+		Deleted:    payload.Deleted || isZeroCommit(payload.After),
+	}
+}
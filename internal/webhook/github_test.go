@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ktappdev/cicd-thing/internal/config"
+)
+
+// pullRequestPayload builds a pull_request delivery whose head lives in
+// headRepo; "null" stands for a deleted fork
+func pullRequestPayload(headRepo string) string {
+	repo := `null`
+	if headRepo != "null" {
+		repo = `{"full_name": "` + headRepo + `"}`
+	}
+	return `{
+		"action": "opened",
+		"number": 42,
+		"pull_request": {
+			"title": "Add a feature",
+			"updated_at": "2026-01-02T03:04:05Z",
+			"head": {"ref": "feature", "sha": "0123456789abcdef0123456789abcdef01234567", "repo": ` + repo + `},
+			"user": {"login": "octocat"}
+		},
+		"repository": {"full_name": "acme/web"}
+	}`
+}
+
+func TestPullRequestPreviewsFromForks(t *testing.T) {
+	tests := []struct {
+		name       string
+		headRepo   string
+		allowForks bool
+		previewed  bool
+	}{
+		{"same repository", "acme/web", false, true},
+		{"same repository, other case", "Acme/Web", false, true},
+		{"fork", "mallory/web", false, false},
+		{"deleted fork", "null", false, false},
+		{"fork allowed", "mallory/web", true, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RepoMap:  map[string]string{"acme/web": t.TempDir()},
+				Previews: map[string]config.Preview{"web": {AllowForks: test.allowForks}},
+			}
+			h := New(cfg, nil, nil, nil, nil)
+
+			r := httptest.NewRequest("POST", "/webhook", nil)
+			r.Header.Set("X-GitHub-Event", "pull_request")
+			events, err := (&githubProvider{}).Parse(r, []byte(pullRequestPayload(test.headRepo)))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("Parse returned %d events, want 1", len(events))
+			}
+			if want := strings.TrimPrefix(test.headRepo, "null"); events[0].HeadRepository != want {
+				t.Errorf("HeadRepository = %q, want %q", events[0].HeadRepository, want)
+			}
+
+			deploymentReq, err := h.processWebhook(events[0], "web")
+			if err != nil {
+				t.Fatalf("processWebhook: %v", err)
+			}
+			if previewed := deploymentReq != nil; previewed != test.previewed {
+				t.Fatalf("previewed = %v, want %v", previewed, test.previewed)
+			}
+			if test.previewed && deploymentReq.PullRequest != 42 {
+				t.Errorf("PullRequest = %d, want 42", deploymentReq.PullRequest)
+			}
+		})
+	}
+}
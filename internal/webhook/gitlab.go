@@ -0,0 +1,128 @@
+package webhook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// GitLabPushPayload represents the GitLab Push Hook and Tag Push Hook payload
+type GitLabPushPayload struct {
+	ObjectKind  string         `json:"object_kind"`
+	Ref         string         `json:"ref"`
+	Before      string         `json:"before"`
+	After       string         `json:"after"`
+	CheckoutSHA string         `json:"checkout_sha"`
+	UserName    string         `json:"user_name"`
+	UserEmail   string         `json:"user_email"`
+	Project     GitLabProject  `json:"project"`
+	Commits     []GitLabCommit `json:"commits"`
+}
+
+// GitLabProject represents the project information in a GitLab payload
+type GitLabProject struct {
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	WebURL            string `json:"web_url"`
+	GitHTTPURL        string `json:"git_http_url"`
+	GitSSHURL         string `json:"git_ssh_url"`
+	DefaultBranch     string `json:"default_branch"`
+}
+
+// GitLabCommit represents a commit in a GitLab push payload
+type GitLabCommit struct {
+	ID        string    `json:"id"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+	URL       string    `json:"url"`
+	Author    Author    `json:"author"`
+	Added     []string  `json:"added"`
+	Modified  []string  `json:"modified"`
+	Removed   []string  `json:"removed"`
+}
+
+// gitlabProvider handles GitLab webhooks authenticated with X-Gitlab-Token
+type gitlabProvider struct {
+	token string
+}
+
+// Name implements Provider
+func (p *gitlabProvider) Name() string {
+	return "gitlab"
+}
+
+// Matches implements Provider
+func (p *gitlabProvider) Matches(r *http.Request) bool {
+	return r.Header.Get("X-Gitlab-Event") != ""
+}
+
+// DeliveryID returns the Idempotency-Key GitLab keeps across retries, or
+// the X-Gitlab-Event-UUID; older versions send neither
+func (p *gitlabProvider) DeliveryID(r *http.Request) string {
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		return key
+	}
+	return r.Header.Get("X-Gitlab-Event-UUID")
+}
+
+// Verify compares the X-Gitlab-Token header with the configured token.
+// GitLab sends the secret as-is rather than signing the body.
+func (p *gitlabProvider) Verify(r *http.Request, body []byte) bool {
+	token := r.Header.Get("X-Gitlab-Token")
+	if token == "" || p.token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(p.token)) == 1
+}
+
+// Parse handles Push Hook and Tag Push Hook events
+func (p *gitlabProvider) Parse(r *http.Request, body []byte) ([]*PushEvent, error) {
+	switch r.Header.Get("X-Gitlab-Event") {
+	case "Push Hook", "Tag Push Hook":
+	default:
+		return nil, nil
+	}
+
+	var payload GitLabPushPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse GitLab payload: %w", err)
+	}
+
+	event := &PushEvent{
+		Provider:   "gitlab",
+		Repository: payload.Project.PathWithNamespace,
+		Ref:        payload.Ref,
+		Commit:     payload.After,
+		Author:     payload.UserName,
+		Deleted:    isZeroCommit(payload.After),
+	}
+	if payload.CheckoutSHA != "" {
+		event.Commit = payload.CheckoutSHA
+	}
+
+	// GitLab has no head_commit; find it among the pushed commits
+	for _, c := range payload.Commits {
+		event.Commits = append(event.Commits, Commit{
+			ID:        c.ID,
+			Message:   c.Message,
+			Timestamp: c.Timestamp,
+			URL:       c.URL,
+			Author:    c.Author,
+			Added:     c.Added,
+			Modified:  c.Modified,
+			Removed:   c.Removed,
+		})
+		if c.ID == event.Commit {
+			event.Message = c.Message
+			event.Timestamp = c.Timestamp
+			if c.Author.Name != "" {
+				event.Author = c.Author.Name
+			}
+		}
+	}
+
+	return []*PushEvent{event}, nil
+}
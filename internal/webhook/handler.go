@@ -1,37 +1,87 @@
 package webhook
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"path"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/ktappdev/cicd-thing/internal/audit"
 	"github.com/ktappdev/cicd-thing/internal/config"
 	"github.com/ktappdev/cicd-thing/internal/deployment"
+	"github.com/ktappdev/cicd-thing/internal/logger"
 	"github.com/ktappdev/cicd-thing/internal/mapping"
 )
 
-// Handler handles GitHub webhook requests
+// Handler handles webhook requests from supported git forges
 type Handler struct {
-	config   *config.Config
-	mapper   *mapping.Mapper
-	executor *deployment.Executor
+	config     atomic.Pointer[config.Config]
+	mapper     *mapping.Mapper
+	executor   *deployment.Executor
+	logger     *logger.Logger
+	deliveries *DeliveryLog // nil when deduplication is off
+	auditor    Auditor      // nil when nothing is audited
+}
+
+// Auditor records actions in the audit log with the client IP of the
+// request they were made in
+type Auditor interface {
+	Audit(r *http.Request, entry audit.Entry)
 }
 
 // New creates a new webhook handler
-func New(cfg *config.Config, executor *deployment.Executor) *Handler {
-	return &Handler{
-		config:   cfg,
-		mapper:   mapping.New(cfg),
-		executor: executor,
+func New(cfg *config.Config, executor *deployment.Executor, logger *logger.Logger, deliveries *DeliveryLog, auditor Auditor) *Handler {
+	h := &Handler{
+		mapper:     mapping.New(cfg),
+		executor:   executor,
+		logger:     logger,
+		deliveries: deliveries,
+		auditor:    auditor,
+	}
+	h.config.Store(cfg)
+	return h
+}
+
+// Reload switches the handler to a new configuration, including webhook
+// secrets
+func (h *Handler) Reload(cfg *config.Config) {
+	h.config.Store(cfg)
+	h.mapper.Reload(cfg)
+}
+
+// providers returns the supported forges with their configured secrets
+func (h *Handler) providers() []Provider {
+	cfg := h.config.Load()
+	gitlabToken := cfg.GitLabToken
+	if gitlabToken == "" {
+		gitlabToken = cfg.WebhookSecret
+	}
+	giteaSecret := cfg.GiteaSecret
+	if giteaSecret == "" {
+		giteaSecret = cfg.WebhookSecret
+	}
+	bitbucketSecret := cfg.BitbucketSecret
+	if bitbucketSecret == "" {
+		bitbucketSecret = cfg.WebhookSecret
+	}
+
+	// Order matters: Gitea also sends X-GitHub-Event, and GitHub is last
+	// because it doubles as the fallback
+	return []Provider{
+		&giteaProvider{secret: giteaSecret},
+		&gitlabProvider{token: gitlabToken},
+		&bitbucketProvider{secret: bitbucketSecret},
+		&githubProvider{secret: cfg.WebhookSecret},
 	}
 }
 
-// HandleWebhook processes incoming GitHub webhook requests
+// HandleWebhook processes incoming webhook requests. The sending forge is
+// detected from the request headers; requests that match no provider are
+// treated as GitHub deliveries.
 func (h *Handler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -46,57 +96,126 @@ func (h *Handler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
+	provider := h.detectProvider(r)
+
 	// Verify the webhook signature
-	if !h.verifySignature(r.Header.Get("X-Hub-Signature-256"), body) {
+	if !provider.Verify(r, body) {
 		http.Error(w, "Invalid signature", http.StatusUnauthorized)
 		return
 	}
 
-	// Check event type
-	eventType := r.Header.Get("X-GitHub-Event")
-	if eventType != "push" {
-		// We only handle push events for now
+	// Retried and replayed deliveries are processed only once
+	delivery := forgeDelivery(provider.Name(), provider.DeliveryID(r), body)
+	if !h.claimDelivery(delivery) {
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Event type not supported"))
+		w.Write([]byte("Delivery already processed"))
 		return
 	}
 
+	// CI results release or drop deployments waiting for checks
+	if checks, ok := provider.(checkProvider); ok {
+		check, err := checks.ParseCheck(r, body)
+		if err != nil {
+			h.releaseDelivery(delivery)
+			http.Error(w, "Failed to parse webhook payload", http.StatusBadRequest)
+			return
+		}
+		if check != nil {
+			h.handleCheck(w, r, provider.Name(), check)
+			return
+		}
+	}
+
 	// Parse the webhook payload
-	var payload GitHubWebhookPayload
-	if err := json.Unmarshal(body, &payload); err != nil {
+	events, err := provider.Parse(r, body)
+	if err != nil {
+		h.releaseDelivery(delivery)
 		http.Error(w, "Failed to parse webhook payload", http.StatusBadRequest)
 		return
 	}
-
-	// Process the webhook
-	deploymentReq, err := h.processWebhook(&payload)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to process webhook: %v", err), http.StatusBadRequest)
+	if events == nil {
+		// We only handle push events for now
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Event type not supported"))
 		return
 	}
 
-	if deploymentReq == nil {
-		// No deployment needed (e.g., wrong branch)
+	triggered, skipped, stale := 0, 0, 0
+
+	// A retry may only run again if nothing ran the first time; apps
+	// already queued would otherwise deploy twice
+	fail := func() {
+		if triggered+skipped == 0 {
+			h.releaseDelivery(delivery)
+		} else {
+			h.logf("%s failed after %d deployment(s) were triggered, a retry will be ignored", delivery, triggered+skipped)
+		}
+	}
+
+	for _, event := range events {
+		if h.tooOld(event) {
+			stale++
+			continue
+		}
+
+		// A monorepo push is considered separately for each of its apps
+		for _, appName := range h.mapper.GetApps(event.Repository) {
+			deploymentReq, err := h.processWebhook(event, appName)
+			if err != nil {
+				fail()
+				http.Error(w, fmt.Sprintf("Failed to process webhook: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			if deploymentReq == nil {
+				// No deployment needed (e.g., wrong branch)
+				continue
+			}
+
+			// A [skip deploy] directive, or an app left out of [deploy: ...],
+			// is recorded but never runs
+			if deploymentReq.SkipReason != "" {
+				h.executor.Skip(deploymentReq.toRequest(), deploymentReq.SkipReason)
+				skipped++
+				continue
+			}
+
+			// Trigger deployment, or hold it until CI passes if the app asks
+			deploy := h.executor.Deploy
+			audited := h.deployEntry(provider.Name()+" webhook", deploymentReq)
+			if h.requiresChecks(deploymentReq) {
+				deploy = h.executor.Hold
+				audited.Detail += ", waiting for checks"
+			}
+			req := deploymentReq.toRequest()
+			if err := deploy(req); err != nil {
+				audited.Outcome, audited.Detail = audit.OutcomeFailure, audited.Detail+": "+err.Error()
+				h.audit(r, audited)
+				fail()
+				http.Error(w, fmt.Sprintf("Failed to trigger deployment: %v", err), http.StatusInternalServerError)
+				return
+			}
+			audited.Outcome, audited.RequestID = audit.OutcomeSuccess, req.ID
+			h.audit(r, audited)
+			triggered++
+		}
+	}
+
+	if triggered == 0 && skipped == 0 && stale > 0 {
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("No deployment triggered"))
+		w.Write([]byte("Delivery too old, ignored"))
 		return
 	}
 
-	// Convert to deployment request and trigger deployment
-	depReq := &deployment.Request{
-		Repository: deploymentReq.Repository,
-		Branch:     deploymentReq.Branch,
-		Commit:     deploymentReq.Commit,
-		Message:    deploymentReq.Message,
-		Author:     deploymentReq.Author,
-		Timestamp:  deploymentReq.Timestamp,
-		LocalPath:  deploymentReq.LocalPath,
-		Manual:     false,
+	if triggered == 0 && skipped > 0 {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Deployment skipped by commit message"))
+		return
 	}
 
-	// Trigger deployment
-	if err := h.executor.Deploy(depReq); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to trigger deployment: %v", err), http.StatusInternalServerError)
+	if triggered == 0 {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("No deployment triggered"))
 		return
 	}
 
@@ -104,58 +223,243 @@ func (h *Handler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Deployment triggered successfully"))
 }
 
-// verifySignature verifies the GitHub webhook signature
-func (h *Handler) verifySignature(signature string, body []byte) bool {
-	if signature == "" || h.config.WebhookSecret == "" {
+// tooOld reports whether a push is older than webhook_max_age_minutes,
+// judged by the timestamp of its commit
+func (h *Handler) tooOld(event *PushEvent) bool {
+	maxAge := time.Duration(h.config.Load().WebhookMaxAgeMinutes) * time.Minute
+	if maxAge <= 0 || event.Timestamp.IsZero() {
 		return false
 	}
-
-	// Remove the "sha256=" prefix
-	if !strings.HasPrefix(signature, "sha256=") {
+	age := time.Since(event.Timestamp)
+	if age <= maxAge {
 		return false
 	}
-	signature = strings.TrimPrefix(signature, "sha256=")
+	h.logf("%s: ignoring push of commit %s, it is %s old (webhook_max_age_minutes is %d)", event.Repository, shortSHA(event.Commit), age.Round(time.Minute), int(maxAge.Minutes()))
+	return true
+}
 
-	// Calculate the expected signature
-	mac := hmac.New(sha256.New, []byte(h.config.WebhookSecret))
-	mac.Write(body)
-	expectedSignature := hex.EncodeToString(mac.Sum(nil))
+// handleCheck releases or drops deployments held for the checked commit
+func (h *Handler) handleCheck(w http.ResponseWriter, r *http.Request, source string, check *CheckEvent) {
+	var passed bool
+	switch check.Conclusion {
+	case "success":
+		passed = true
+	case "failure", "timed_out", "cancelled", "action_required", "startup_failure":
+		passed = false
+	default:
+		// Neutral, skipped and stale runs say nothing about the commit
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("No deployment waiting for checks"))
+		return
+	}
 
-	// Compare signatures
-	return hmac.Equal([]byte(signature), []byte(expectedSignature))
+	released, dropped, waiting := h.executor.ReleaseChecks(check.Repository, check.Commit, check.Name, passed)
+	for _, req := range released {
+		h.audit(r, audit.Entry{Credential: source + " webhook", Action: audit.ActionApprove, Outcome: audit.OutcomeSuccess, App: req.App, RequestID: req.ID, Detail: fmt.Sprintf("checks passed for %s commit %s", req.Repository, req.Commit)})
+	}
+	for _, req := range dropped {
+		h.audit(r, audit.Entry{Credential: source + " webhook", Action: audit.ActionApprove, Outcome: audit.OutcomeFailure, App: req.App, RequestID: req.ID, Detail: fmt.Sprintf("check %s failed for %s commit %s", check.Name, req.Repository, req.Commit)})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	switch {
+	case len(dropped) > 0:
+		w.Write([]byte("Checks failed, deployment dropped"))
+	case len(released) > 0:
+		w.Write([]byte("Checks passed, deployment released"))
+	case waiting > 0:
+		w.Write([]byte("Check passed, deployment still waiting for other checks"))
+	default:
+		w.Write([]byte("No deployment waiting for checks"))
+	}
+}
+
+// deployEntry starts the audit entry of a deployment triggered by a
+// webhook; the caller fills in the outcome
+func (h *Handler) deployEntry(credential string, deploymentReq *DeploymentRequest) audit.Entry {
+	ref := deploymentReq.Branch
+	if deploymentReq.Tag != "" {
+		ref = deploymentReq.Tag
+	}
+	detail := deploymentReq.Repository + "@" + ref
+	if deploymentReq.Commit != "" {
+		detail += " commit " + deploymentReq.Commit
+	}
+	return audit.Entry{
+		Credential: credential,
+		Action:     audit.ActionDeploy,
+		App:        deploymentReq.App,
+		Detail:     detail,
+	}
+}
+
+// audit records an action taken for a webhook delivery, on behalf of the
+// system identity since nobody logged in to send it
+func (h *Handler) audit(r *http.Request, entry audit.Entry) {
+	if h.auditor == nil {
+		return
+	}
+	entry.Identity = audit.SystemIdentity
+	h.auditor.Audit(r, entry)
+}
+
+// requiresChecks reports whether a deployment must wait for CI. Removing a
+// preview never waits, and neither do tags and releases: their Commit is a
+// tag name or tag object, never the head SHA CI reports on.
+func (h *Handler) requiresChecks(deploymentReq *DeploymentRequest) bool {
+	if _, gated := h.config.Load().Checks[deploymentReq.App]; !gated || deploymentReq.Teardown {
+		return false
+	}
+	if deploymentReq.Tag != "" {
+		h.logf("%s: not waiting for checks on tag %s of %s", deploymentReq.Repository, deploymentReq.Tag, deploymentReq.App)
+		return false
+	}
+	return true
 }
 
-// processWebhook processes the webhook payload and returns a deployment request
-func (h *Handler) processWebhook(payload *GitHubWebhookPayload) (*DeploymentRequest, error) {
-	// Extract branch name from ref (refs/heads/main -> main)
-	branch := strings.TrimPrefix(payload.Ref, "refs/heads/")
+// detectProvider picks the provider that sent the request
+func (h *Handler) detectProvider(r *http.Request) Provider {
+	providers := h.providers()
+	for _, provider := range providers {
+		if provider.Matches(r) {
+			return provider
+		}
+	}
+	return providers[len(providers)-1]
+}
+
+// processWebhook turns a push event into a deployment request for one of
+// the repository's apps, or nil if the push should not deploy that app
+func (h *Handler) processWebhook(event *PushEvent, appName string) (*DeploymentRequest, error) {
+	if event.Deleted {
+		return nil, nil // Nothing to deploy for a deleted ref
+	}
+
+	if !h.pathsChanged(event, appName) {
+		return nil, nil // The push didn't touch this app
+	}
+
+	if event.PullRequest > 0 {
+		deploymentReq, err := h.processPullRequest(event, appName)
+		if err != nil || deploymentReq == nil {
+			return nil, err
+		}
+		h.applyDirectives(deploymentReq)
+		return deploymentReq, nil
+	}
+
+	branch := event.Branch()
+	tag := event.Tag()
+	var environment *config.Environment
+	switch {
+	case tag != "":
+		// Tags and releases only deploy when the app opts in
+		if !h.tagTriggered(event, appName, tag) {
+			return nil, nil
+		}
+	case branch == "":
+		return nil, nil // Neither a branch nor a tag
+	default:
+		env, err := h.mapper.ResolveEnvironment(appName, branch)
+		if errors.Is(err, mapping.ErrNoEnvironment) {
+			return nil, nil // No environment for this branch
+		}
+		if err != nil {
+			return nil, err
+		}
 
-	// Check if we should deploy this branch
-	if h.config.BranchFilter != "" && branch != h.config.BranchFilter {
-		return nil, nil // No deployment needed
+		// Apps without environments use the global branch filter
+		if filter := h.config.Load().BranchFilter; env == nil && filter != "" && branch != filter {
+			return nil, nil // No deployment needed
+		}
+		environment = env
 	}
 
 	// Get local path using mapper
-	localPath, err := h.mapper.GetLocalPath(payload.Repository.FullName)
+	localPath, err := h.mapper.GetEnvironmentPath(event.Repository, appName, environment)
 	if err != nil {
 		return nil, err
 	}
 
 	// Create deployment request
 	deploymentReq := &DeploymentRequest{
-		Repository: payload.Repository.FullName,
+		Repository: event.Repository,
+		App:        appName,
 		Branch:     branch,
-		Commit:     payload.After,
-		Message:    payload.HeadCommit.Message,
-		Author:     payload.HeadCommit.Author.Name,
-		Timestamp:  payload.HeadCommit.Timestamp,
+		Commit:     event.Commit,
+		Message:    event.Message,
+		Author:     event.Author,
+		Timestamp:  event.Timestamp,
 		LocalPath:  localPath,
+		Tag:        tag,
 	}
+	if environment != nil {
+		deploymentReq.Environment = environment.Name
+	}
+
+	h.applyDirectives(deploymentReq)
 
 	return deploymentReq, nil
 }
 
-// GetDeploymentRequest extracts deployment information from a webhook payload
+// processPullRequest turns pull request activity into a preview deployment
+// or teardown, or nil if the app has no previews configured. Pull requests
+// from forks run someone else's code on this host, so they are refused
+// unless the app allows forks.
+func (h *Handler) processPullRequest(event *PushEvent, appName string) (*DeploymentRequest, error) {
+	preview, enabled := h.config.Load().Previews[appName]
+	if !enabled {
+		return nil, nil
+	}
+	if !preview.AllowForks && !strings.EqualFold(event.HeadRepository, event.Repository) {
+		head := event.HeadRepository
+		if head == "" {
+			head = "an unknown repository"
+		}
+		h.logf("%s: not previewing pull request #%d for %s, its head is in %s (set allow_forks to preview forks)", event.Repository, event.PullRequest, appName, head)
+		return nil, nil
+	}
+
+	previewPath, err := h.mapper.GetPreviewPath(event.Repository, appName, event.PullRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeploymentRequest{
+		Repository:  event.Repository,
+		App:         appName,
+		Branch:      event.Branch(),
+		Commit:      event.Commit,
+		Message:     event.Message,
+		Author:      event.Author,
+		Timestamp:   event.Timestamp,
+		LocalPath:   previewPath,
+		PullRequest: event.PullRequest,
+		Teardown:    event.Closed,
+	}, nil
+}
+
+// tagTriggered reports whether a tag push or release should deploy the app
+func (h *Handler) tagTriggered(event *PushEvent, appName, tag string) bool {
+	trigger, exists := h.config.Load().Triggers[appName]
+	if !exists {
+		return false
+	}
+
+	if event.Release {
+		return trigger.Releases
+	}
+
+	for _, pattern := range trigger.Tags {
+		if matched, _ := path.Match(pattern, tag); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDeploymentRequest extracts deployment information from a GitHub webhook payload
 func (h *Handler) GetDeploymentRequest(payload *GitHubWebhookPayload) (*DeploymentRequest, error) {
-	return h.processWebhook(payload)
+	event := pushEventFromGitHub(payload)
+	return h.processWebhook(event, h.mapper.GetApps(event.Repository)[0])
 }
@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// pathsChanged reports whether a push touches any of the app's monorepo
+// paths. Apps outside a monorepo, and events that carry no file list
+// (tags, pull requests, generic hooks), always count as changed.
+func (h *Handler) pathsChanged(event *PushEvent, appName string) bool {
+	app, exists := h.mapper.GetMonorepoApp(event.Repository, appName)
+	if !exists || (len(app.Include) == 0 && len(app.Exclude) == 0) {
+		return true
+	}
+
+	files := changedFiles(event.Commits)
+	if len(files) == 0 {
+		h.logf("%s: deploying %s, push carries no file list", event.Repository, appName)
+		return true
+	}
+
+	for _, file := range files {
+		if matchesAny(app.Include, file, true) && !matchesAny(app.Exclude, file, false) {
+			h.logf("%s: deploying %s, %s changed (%d files in push)", event.Repository, appName, file, len(files))
+			return true
+		}
+	}
+
+	h.logf("%s: skipping %s, none of %d changed files match its paths", event.Repository, appName, len(files))
+	return false
+}
+
+// logf logs an informational message if the handler has a logger
+func (h *Handler) logf(format string, args ...interface{}) {
+	if h.logger != nil {
+		h.logger.LogInfo(fmt.Sprintf(format, args...))
+	}
+}
+
+// changedFiles collects the files added, modified or removed by commits
+func changedFiles(commits []Commit) []string {
+	seen := make(map[string]bool)
+	var files []string
+	for _, commit := range commits {
+		for _, list := range [][]string{commit.Added, commit.Modified, commit.Removed} {
+			for _, file := range list {
+				if !seen[file] {
+					seen[file] = true
+					files = append(files, file)
+				}
+			}
+		}
+	}
+	return files
+}
+
+// matchesAny reports whether file matches one of patterns, returning empty
+// when there are no patterns
+func matchesAny(patterns []string, file string, empty bool) bool {
+	if len(patterns) == 0 {
+		return empty
+	}
+	for _, pattern := range patterns {
+		if matchGlob(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a slash-separated path against a glob in which "**"
+// stands for any number of directories, e.g. "services/api/**" or "**/*.md"
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchSegments matches path segments one by one, backtracking over "**"
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], name[0]); !matched {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
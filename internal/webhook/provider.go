@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Provider understands the webhook format of one git forge. Each provider
+// verifies its own deliveries and normalizes them into PushEvents so that
+// mapping, branch filtering and execution are shared.
+type Provider interface {
+	// Name identifies the provider in logs and responses
+	Name() string
+	// Matches reports whether a request was sent by this provider
+	Matches(r *http.Request) bool
+	// Verify checks that the delivery is authentic
+	Verify(r *http.Request, body []byte) bool
+	// DeliveryID returns the forge's ID of the delivery, which stays the
+	// same across retries, or "" if it sent none
+	DeliveryID(r *http.Request) string
+	// Parse extracts push events from a delivery; nil means the event type
+	// is not one we deploy on
+	Parse(r *http.Request, body []byte) ([]*PushEvent, error)
+}
+
+// checkProvider is implemented by providers that also report CI results,
+// which release deployments held for checks
+type checkProvider interface {
+	// ParseCheck extracts a finished CI run from a delivery; nil means the
+	// delivery is not a CI result
+	ParseCheck(r *http.Request, body []byte) (*CheckEvent, error)
+}
+
+// CheckEvent reports a finished CI run for a commit
+type CheckEvent struct {
+	Repository string
+	Commit     string
+	Name       string // workflow or check suite app name
+	Conclusion string // "success", "failure", ...
+}
+
+// PushEvent is a forge-agnostic description of a ref update
+type PushEvent struct {
+	Provider   string
+	Repository string // full name, e.g. "octocat/Hello-World"
+	Ref        string // full ref, e.g. "refs/heads/main"
+	Commit     string
+	Message    string
+	Author     string
+	Timestamp  time.Time
+	Commits    []Commit
+	Deleted    bool // the ref was deleted, nothing to deploy
+	Release    bool // a published release rather than a plain tag push
+
+	PullRequest    int    // pull request number; Ref is then the head branch
+	HeadRepository string // repository the head branch lives in; "" if unknown
+	Closed         bool   // the pull request was closed or merged
+}
+
+// Branch returns the branch name for branch pushes and "" otherwise
+func (e *PushEvent) Branch() string {
+	if strings.HasPrefix(e.Ref, "refs/heads/") {
+		return strings.TrimPrefix(e.Ref, "refs/heads/")
+	}
+	return ""
+}
+
+// Tag returns the tag name for tag pushes and "" otherwise
+func (e *PushEvent) Tag() string {
+	if strings.HasPrefix(e.Ref, "refs/tags/") {
+		return strings.TrimPrefix(e.Ref, "refs/tags/")
+	}
+	return ""
+}
+
+// isZeroCommit reports whether sha is the all-zero SHA forges send for deleted refs
+func isZeroCommit(sha string) bool {
+	return sha != "" && strings.Trim(sha, "0") == ""
+}
+
+// validHMAC reports whether signature is the hex HMAC-SHA256 of body keyed with secret
+func validHMAC(secret, signature string, body []byte) bool {
+	if signature == "" || secret == "" {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expectedSignature := hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(signature), []byte(expectedSignature))
+}
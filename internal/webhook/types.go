@@ -1,18 +1,93 @@
 package webhook
 
-import "time"
+import (
+	"time"
+
+	"github.com/ktappdev/cicd-thing/internal/deployment"
+)
 
 // GitHubWebhookPayload represents the GitHub webhook payload structure
 type GitHubWebhookPayload struct {
 	Ref        string     `json:"ref"`
 	Before     string     `json:"before"`
 	After      string     `json:"after"`
+	Deleted    bool       `json:"deleted"`
 	Repository Repository `json:"repository"`
 	Pusher     Pusher     `json:"pusher"`
 	HeadCommit HeadCommit `json:"head_commit"`
 	Commits    []Commit   `json:"commits"`
 }
 
+// GitHubReleasePayload represents the GitHub release webhook payload
+type GitHubReleasePayload struct {
+	Action     string        `json:"action"`
+	Release    GitHubRelease `json:"release"`
+	Repository Repository    `json:"repository"`
+}
+
+// GitHubRelease represents the release information in a release payload
+type GitHubRelease struct {
+	TagName         string    `json:"tag_name"`
+	TargetCommitish string    `json:"target_commitish"`
+	Name            string    `json:"name"`
+	Body            string    `json:"body"`
+	Draft           bool      `json:"draft"`
+	Prerelease      bool      `json:"prerelease"`
+	PublishedAt     time.Time `json:"published_at"`
+	Author          struct {
+		Login string `json:"login"`
+	} `json:"author"`
+}
+
+// GitHubPullRequestPayload represents the GitHub pull_request webhook payload
+type GitHubPullRequestPayload struct {
+	Action      string            `json:"action"`
+	Number      int               `json:"number"`
+	PullRequest GitHubPullRequest `json:"pull_request"`
+	Repository  Repository        `json:"repository"`
+}
+
+// GitHubPullRequest represents the pull request in a pull_request payload
+type GitHubPullRequest struct {
+	Title     string    `json:"title"`
+	Merged    bool      `json:"merged"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Head      struct {
+		Ref  string `json:"ref"`
+		SHA  string `json:"sha"`
+		Repo *struct {
+			FullName string `json:"full_name"`
+		} `json:"repo"` // null once a fork is deleted
+	} `json:"head"`
+	User struct {
+		Login string `json:"login"`
+	} `json:"user"`
+}
+
+// GitHubWorkflowRunPayload represents the GitHub workflow_run webhook payload
+type GitHubWorkflowRunPayload struct {
+	Action      string `json:"action"`
+	WorkflowRun struct {
+		Name       string `json:"name"`
+		HeadSHA    string `json:"head_sha"`
+		Conclusion string `json:"conclusion"`
+	} `json:"workflow_run"`
+	Repository Repository `json:"repository"`
+}
+
+// GitHubCheckSuitePayload represents the GitHub check_suite webhook payload
+type GitHubCheckSuitePayload struct {
+	Action     string `json:"action"`
+	CheckSuite struct {
+		HeadSHA    string `json:"head_sha"`
+		Conclusion string `json:"conclusion"`
+		App        struct {
+			Name string `json:"name"`
+		} `json:"app"`
+	} `json:"check_suite"`
+	Repository Repository `json:"repository"`
+}
+
 // Repository represents the repository information in the webhook payload
 type Repository struct {
 	ID       int    `json:"id"`
@@ -69,11 +144,40 @@ type Author struct {
 
 // DeploymentRequest represents a deployment request extracted from webhook
 type DeploymentRequest struct {
-	Repository string
-	Branch     string
-	Commit     string
-	Message    string
-	Author     string
-	Timestamp  time.Time
-	LocalPath  string
+	Repository  string
+	App         string
+	Branch      string
+	Commit      string
+	Message     string
+	Author      string
+	Timestamp   time.Time
+	LocalPath   string
+	Environment string   // named environment the branch maps to, if any
+	Tag         string   // set for tag and release deployments
+	PullRequest int      // set for pull request previews
+	Teardown    bool     // the pull request was closed
+	Directives  []string // commit message directives that applied
+	NoRollback  bool     // [no-rollback] was given
+	SkipReason  string   // set when a directive suppresses the deployment
+}
+
+// toRequest converts the webhook request into an executor request
+func (d *DeploymentRequest) toRequest() *deployment.Request {
+	return &deployment.Request{
+		Repository:  d.Repository,
+		App:         d.App,
+		Branch:      d.Branch,
+		Commit:      d.Commit,
+		Message:     d.Message,
+		Author:      d.Author,
+		Timestamp:   d.Timestamp,
+		LocalPath:   d.LocalPath,
+		Environment: d.Environment,
+		Tag:         d.Tag,
+		PullRequest: d.PullRequest,
+		Teardown:    d.Teardown,
+		Directives:  d.Directives,
+		NoRollback:  d.NoRollback,
+		Manual:      false,
+	}
 }
@@ -1,21 +1,36 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/ktappdev/cicd-thing/internal/audit"
 	"github.com/ktappdev/cicd-thing/internal/config"
 	"github.com/ktappdev/cicd-thing/internal/deployment"
+	"github.com/ktappdev/cicd-thing/internal/history"
 	"github.com/ktappdev/cicd-thing/internal/logger"
 	"github.com/ktappdev/cicd-thing/internal/notifications"
 	"github.com/ktappdev/cicd-thing/internal/server"
+	"github.com/ktappdev/cicd-thing/internal/validate"
+	"github.com/ktappdev/cicd-thing/internal/webhook"
 )
 
 func main() {
+	// "cicd-thing validate" checks the configuration and exits
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(validate.Run(os.Args[2:], os.Stdout))
+	}
+
+	configPath := flag.String("config", "", "config file to use instead of searching for config.toml (or set CICD_CONFIG)")
+	flag.Parse()
+
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := loadConfig(*configPath)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
@@ -28,20 +43,60 @@ func main() {
 	defer deployLogger.Close()
 
 	deployLogger.LogInfo("Starting CI/CD Thing deployment orchestrator")
+	deployLogger.LogInfo("Configuration loaded from " + cfg.Path)
+	for _, line := range cfg.Describe() {
+		deployLogger.LogInfo("Config " + line)
+	}
+	for _, note := range cfg.Notes() {
+		deployLogger.LogInfo("Config: " + note)
+	}
 
 	// Initialize notification system
 	notifier := notifications.New(cfg)
 	deployLogger.LogInfo("Notification system initialized")
 
+	// Initialize deployment history
+	retention := time.Duration(cfg.HistoryRetentionDays) * 24 * time.Hour
+	historyStore, err := history.NewFileStore(cfg.HistoryFile, retention, cfg.HistoryMaxEntries, cfg.HistoryMaxOutputBytes, deployLogger)
+	if err != nil {
+		log.Fatalf("Failed to initialize deployment history: %v", err)
+	}
+	defer historyStore.Close()
+	deployLogger.LogInfo("Deployment history initialized")
+
+	// Open the audit log and check nobody has tampered with it
+	auditLog, err := audit.Open(cfg.AuditFile)
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+	if verified, err := auditLog.Verify(); err != nil {
+		deployLogger.LogError(fmt.Sprintf("Audit log %s failed verification after %d entries", cfg.AuditFile, verified), err)
+	} else {
+		deployLogger.LogInfo(fmt.Sprintf("Audit log verified (%d entries)", verified))
+	}
+
+	// Remember webhook deliveries so retries and replays deploy only once
+	var deliveries *webhook.DeliveryLog
+	if cfg.DeliveryWindow > 0 {
+		deliveries, err = webhook.OpenDeliveryLog(cfg.DeliveryFile, cfg.DeliveryWindow)
+		if err != nil {
+			log.Fatalf("Failed to open webhook delivery log: %v", err)
+		}
+		defer deliveries.Close()
+		deployLogger.LogInfo("Webhook delivery log initialized")
+	}
+
 	// Initialize deployment executor
 	executor := deployment.New(cfg)
 	deployLogger.LogInfo("Deployment executor initialized")
 
 	// Start deployment result processor
-	go processDeploymentResults(executor, deployLogger, notifier)
+	go processDeploymentResults(executor, deployLogger, notifier, historyStore, auditLog)
 
 	// Create and start the server
-	srv := server.New(cfg, executor, deployLogger)
+	srv := server.New(cfg, executor, deployLogger, historyStore, auditLog, deliveries)
+	srv.OnReload(notifier.Reload)
 	deployLogger.LogInfo("Server initialized")
 
 	// Handle graceful shutdown
@@ -51,32 +106,89 @@ func main() {
 		}
 	}()
 
-	// Wait for interrupt signal
+	// Wait for interrupt signal; SIGHUP reloads the configuration
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	<-c
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range c {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		deployLogger.LogInfo("Received SIGHUP, reloading configuration")
+		entry := audit.Entry{Identity: audit.SystemIdentity, Action: audit.ActionReload, Outcome: audit.OutcomeSuccess}
+		if changes, err := srv.Reload(); err != nil {
+			deployLogger.LogError("Configuration reload failed, keeping the current configuration", err)
+			entry.Outcome, entry.Detail = audit.OutcomeFailure, "SIGHUP: "+err.Error()
+		} else {
+			entry.Detail = fmt.Sprintf("SIGHUP: %d change(s)", len(changes))
+		}
+		if err := auditLog.Record(entry); err != nil {
+			deployLogger.LogError("Failed to write audit log", err)
+		}
+	}
 
 	deployLogger.LogInfo("Shutting down CI/CD Thing deployment orchestrator")
 }
 
-// processDeploymentResults processes deployment results and logs them
-func processDeploymentResults(executor *deployment.Executor, deployLogger *logger.Logger, notifier *notifications.Notifier) {
+// loadConfig loads the config file given with --config, or finds one
+func loadConfig(path string) (*config.Config, error) {
+	if path != "" {
+		return config.LoadFile(path)
+	}
+	return config.Load()
+}
+
+// processDeploymentResults processes deployment results, logs and records them
+func processDeploymentResults(executor *deployment.Executor, deployLogger *logger.Logger, notifier *notifications.Notifier, historyStore history.Store, auditLog *audit.Log) {
 	for result := range executor.GetResults() {
 		deployLogger.LogDeploymentResult(result)
 
+		// Persist to deployment history
+		if err := historyStore.Record(result); err != nil {
+			deployLogger.LogError("Failed to record deployment history for "+result.Request.ID, err)
+		}
+
 		// Send notifications
 		notifier.NotifyDeploymentResult(result)
 
+		// A failed or timed out deployment whose rollback failed too
+		if result.RollbackError != "" {
+			recordRollback(auditLog, deployLogger, result, audit.OutcomeFailure, "rollback failed: "+result.RollbackError)
+		}
+
 		// Log additional info based on status
 		switch result.Status {
 		case deployment.StatusSuccess:
-			deployLogger.LogInfo("Deployment completed successfully for " + result.Request.Repository)
+			deployLogger.LogInfo("Deployment completed successfully for " + result.Request.App)
 		case deployment.StatusFailed:
-			deployLogger.LogError("Deployment failed for "+result.Request.Repository, nil)
+			deployLogger.LogError("Deployment failed for "+result.Request.App, nil)
 		case deployment.StatusTimeout:
-			deployLogger.LogError("Deployment timed out for "+result.Request.Repository, nil)
+			deployLogger.LogError("Deployment timed out for "+result.Request.App, nil)
 		case deployment.StatusRollback:
-			deployLogger.LogInfo("Deployment rolled back for " + result.Request.Repository)
+			deployLogger.LogInfo("Deployment rolled back for " + result.Request.App)
+			recordRollback(auditLog, deployLogger, result, audit.OutcomeSuccess, result.Error)
+		case deployment.StatusCancelled:
+			deployLogger.LogInfo("Deployment cancelled for " + result.Request.App)
+		case deployment.StatusChecksFailed:
+			deployLogger.LogError("Deployment for "+result.Request.App+" dropped: "+result.Error, nil)
+		case deployment.StatusSkipped:
+			deployLogger.LogInfo("Deployment " + result.Request.ID + " for " + result.Request.App + " not run: " + result.Error)
+		case deployment.StatusSuperseded:
+			deployLogger.LogInfo("Deployment " + result.Request.ID + " for " + result.Request.App + " superseded by " + result.SupersededBy)
 		}
 	}
 }
+
+// recordRollback writes an automatic rollback to the audit log
+func recordRollback(auditLog *audit.Log, deployLogger *logger.Logger, result *deployment.Result, outcome, detail string) {
+	entry := audit.Entry{
+		Identity:  audit.SystemIdentity,
+		Action:    audit.ActionRollback,
+		Outcome:   outcome,
+		App:       result.Request.App,
+		RequestID: result.Request.ID,
+		Detail:    detail,
+	}
+	if err := auditLog.Record(entry); err != nil {
+		deployLogger.LogError("Failed to write audit log", err)
+	}
+}